@@ -0,0 +1,42 @@
+package breaker
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// pendingCall is a call admitted by Allow whose outcome is not reported yet.
+type pendingCall struct {
+	reported atomic.Bool
+
+	record func(Outcome, error)
+}
+
+// newPendingCall returns the done func of an admitted call.
+//
+// Only the first report is recorded, later ones are ignored. Callers must
+// call done, a finalizer is only a best-effort backstop for the ones that
+// leak it: the call is then recorded as a failure whenever the garbage
+// collector runs, in the bucket current at that time and with a latency
+// that includes the delay, so a leaked call does not keep a half-open
+// breaker waiting forever.
+func newPendingCall(record func(Outcome, error)) func(Outcome, error) {
+	c := &pendingCall{record: record}
+	runtime.SetFinalizer(c, (*pendingCall).abandon)
+	return c.done
+}
+
+func (c *pendingCall) done(outcome Outcome, err error) {
+	if !c.reported.CompareAndSwap(false, true) {
+		return
+	}
+
+	runtime.SetFinalizer(c, nil)
+	c.record(outcome, err)
+}
+
+func (c *pendingCall) abandon() {
+	if c.reported.CompareAndSwap(false, true) {
+		c.record(OutcomeFailure, nil)
+	}
+}
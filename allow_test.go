@@ -0,0 +1,200 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func Test_googleBreaker_Allow(t *testing.T) {
+	tests := []struct {
+		name         string
+		report       func(done func(Outcome, error))
+		wantAccepts  float64
+		wantRequests float64
+	}{
+		{
+			name:         "success",
+			report:       func(done func(Outcome, error)) { done(OutcomeSuccess, nil) },
+			wantAccepts:  1,
+			wantRequests: 1,
+		}, {
+			name:         "failure",
+			report:       func(done func(Outcome, error)) { done(OutcomeFailure, nil) },
+			wantAccepts:  0,
+			wantRequests: 1,
+		}, {
+			name:         "ignored",
+			report:       func(done func(Outcome, error)) { done(OutcomeIgnored, nil) },
+			wantAccepts:  0,
+			wantRequests: 0,
+		}, {
+			name: "only the first report counts",
+			report: func(done func(Outcome, error)) {
+				done(OutcomeSuccess, nil)
+				done(OutcomeFailure, nil)
+				done(OutcomeSuccess, nil)
+			},
+			wantAccepts:  1,
+			wantRequests: 1,
+		}, {
+			name: "report from another goroutine",
+			report: func(done func(Outcome, error)) {
+				ch := make(chan struct{})
+				go func() {
+					defer close(ch)
+					done(OutcomeSuccess, nil)
+				}()
+				<-ch
+			},
+			wantAccepts:  1,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewGoogleBreaker()
+			done, err := b.Allow()
+			if err != nil {
+				t.Fatalf("Allow() error = %v, wantErr nil", err)
+			}
+			tt.report(done)
+			accepts, requests := b.history()
+			if accepts != tt.wantAccepts || requests != tt.wantRequests {
+				t.Errorf("history() = (%v, %v), want (%v, %v)", accepts, requests, tt.wantAccepts, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_Allow_cause(t *testing.T) {
+	b := NewGoogleBreaker()
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v, wantErr nil", err)
+	}
+	done(OutcomeFailure, errTest)
+
+	b.ForceOpen()
+	var rejected *RejectedError
+	if _, err = b.Allow(); !errors.As(err, &rejected) || rejected.Cause != errTest {
+		t.Errorf("Allow() error = %v, want a *RejectedError caused by %v", err, errTest)
+	}
+}
+
+func Test_googleBreaker_AllowContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		wantErr error
+	}{
+		{name: "critical", ctx: ContextWithCriticality(context.Background(), Critical), wantErr: nil},
+		{name: "sheddable", ctx: ContextWithCriticality(context.Background(), Sheddable), wantErr: ErrServiceUnavailable},
+		{name: "canceled", ctx: canceled, wantErr: context.Canceled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// (2 - 1.5*1) / (2 + 1) is 1/6, and 1/3 for Sheddable.
+			b := NewGoogleBreaker(WithRandSource(breakertest.NewSource(0.25)))
+			_ = b.Do(succeed)
+			_ = b.Do(fail)
+
+			done, err := b.AllowContext(tt.ctx)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("AllowContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (done == nil) != (tt.wantErr != nil) {
+				t.Errorf("AllowContext() done = %p, wantErr %v", done, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_pendingCall_abandon(t *testing.T) {
+	tests := []struct {
+		name   string
+		report func(c *pendingCall)
+		want   []Outcome
+	}{
+		{
+			name:   "abandoned",
+			report: func(c *pendingCall) { c.abandon() },
+			want:   []Outcome{OutcomeFailure},
+		}, {
+			name: "reported then abandoned",
+			report: func(c *pendingCall) {
+				c.done(OutcomeSuccess, nil)
+				c.abandon()
+			},
+			want: []Outcome{OutcomeSuccess},
+		}, {
+			name: "abandoned then reported",
+			report: func(c *pendingCall) {
+				c.abandon()
+				c.done(OutcomeSuccess, nil)
+			},
+			want: []Outcome{OutcomeFailure},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Outcome
+			c := &pendingCall{record: func(outcome Outcome, _ error) { got = append(got, outcome) }}
+			tt.report(c)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("recorded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_classicBreaker_Allow(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := newTestClassicBreaker(clock, WithMaxFailures(1), WithOpenTimeout(time.Second))
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v, wantErr nil", err)
+	}
+	done(OutcomeFailure, errTest)
+
+	var rejected *RejectedError
+	if _, err = b.Allow(); !errors.As(err, &rejected) || rejected.Cause != errTest {
+		t.Errorf("Allow() error = %v, want a *RejectedError caused by %v", err, errTest)
+	}
+
+	clock.Advance(time.Second)
+	done, err = b.Allow()
+	if err != nil {
+		t.Fatalf("Allow() error = %v, wantErr nil", err)
+	}
+	done(OutcomeSuccess, nil)
+
+	if state := b.State(); state != StateClosed {
+		t.Errorf("State() = %v, want %v", state, StateClosed)
+	}
+}
+
+func Test_classicBreaker_AllowContext(t *testing.T) {
+	b := NewClassicBreaker()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if done, err := b.AllowContext(ctx); !errors.Is(err, context.Canceled) || done != nil {
+		t.Errorf("AllowContext() = (%p, %v), want (nil, %v)", done, err, context.Canceled)
+	}
+
+	done, err := b.AllowContext(context.Background())
+	if err != nil {
+		t.Fatalf("AllowContext() error = %v, wantErr nil", err)
+	}
+	done(OutcomeSuccess, nil)
+}
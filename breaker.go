@@ -1,9 +1,71 @@
 package breaker
 
-import "errors"
+import (
+	"context"
+	"errors"
+)
 
 type Breaker interface {
 	Do(func() error) error
 }
 
+// ContextBreaker is an optional extension of Breaker for calls that
+// carry a context.Context.
+type ContextBreaker interface {
+	Breaker
+
+	// DoContext rejects immediately if ctx is already done, otherwise it
+	// behaves like Do and passes ctx through to f.
+	DoContext(ctx context.Context, f func(context.Context) error) error
+}
+
+// Allower is an optional extension of Breaker for calls that cannot be
+// wrapped in a closure, such as streams, callbacks and async pipelines.
+type Allower interface {
+	// Allow reports whether a call may proceed. If it may, the outcome of
+	// the call must be reported through done exactly once, with the error
+	// of the call, if any, which a failure keeps as the cause of later
+	// rejections.
+	Allow() (done func(Outcome, error), err error)
+
+	// AllowContext is like Allow, but it rejects the call with ctx.Err()
+	// if ctx is already done, and throttles it by the criticality carried
+	// by ctx, see ContextWithCriticality.
+	AllowContext(ctx context.Context) (done func(Outcome, error), err error)
+}
+
+// Outcome is how a breaker records the result of a call.
+type Outcome int
+
+const (
+	// OutcomeSuccess records the call as a success.
+	OutcomeSuccess Outcome = iota
+	// OutcomeFailure records the call as a failure.
+	OutcomeFailure
+	// OutcomeIgnored does not record the call at all.
+	OutcomeIgnored
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case OutcomeSuccess:
+		return "success"
+	case OutcomeFailure:
+		return "failure"
+	case OutcomeIgnored:
+		return "ignored"
+	default:
+		return "unknown"
+	}
+}
+
+// ClassifyError is the default error classifier, a nil error is a success
+// and any other error is a failure.
+func ClassifyError(err error) Outcome {
+	if err == nil {
+		return OutcomeSuccess
+	}
+	return OutcomeFailure
+}
+
 var ErrServiceUnavailable = errors.New("circuit breaker is open")
@@ -0,0 +1,176 @@
+// Package breakergrpc protects gRPC clients and servers with circuit
+// breakers, through interceptors.
+package breakergrpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+
+	"github.com/chenyanchen/breaker"
+)
+
+type Option func(*options)
+
+type options struct {
+	registry     *breaker.Registry
+	key          func(target, method string) string
+	failureCodes []codes.Code
+}
+
+// WithRegistry sets the registry the breakers are looked up in, it
+// defaults to breaker.NewRegistry().
+func WithRegistry(r *breaker.Registry) Option {
+	return func(o *options) { o.registry = r }
+}
+
+// WithKey sets the name of the breaker of a call, from the target of the
+// client connection, empty on servers, and the full method name. It
+// defaults to MethodKey.
+func WithKey(key func(target, method string) string) Option {
+	return func(o *options) { o.key = key }
+}
+
+// WithFailureCodes sets the status codes recorded as failures, any other
+// code is a success. They default to Unavailable, DeadlineExceeded and
+// ResourceExhausted.
+func WithFailureCodes(failureCodes ...codes.Code) Option {
+	return func(o *options) { o.failureCodes = append([]codes.Code(nil), failureCodes...) }
+}
+
+// MethodKey keeps one breaker per method.
+func MethodKey(_, method string) string { return method }
+
+// TargetKey keeps one breaker per target, e.g. per backend service.
+func TargetKey(target, _ string) string { return target }
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		key:          MethodKey,
+		failureCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted},
+	}
+
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if o.registry == nil {
+		// A registry without options is always valid.
+		o.registry, _ = breaker.NewRegistry()
+	}
+
+	return o
+}
+
+// outcome classifies the error of a call made with ctx.
+func (o *options) outcome(ctx context.Context, err error) breaker.Outcome {
+	if err == nil {
+		return breaker.OutcomeSuccess
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		// The caller gave up, the backend is not to blame.
+		return breaker.OutcomeIgnored
+	}
+	if slices.Contains(o.failureCodes, status.Code(err)) {
+		return breaker.OutcomeFailure
+	}
+	return breaker.OutcomeSuccess
+}
+
+// call makes call through the breaker of key, with ctx the context of
+// the call. A rejection fails with a status of code, and a panic of call
+// is recorded as a failure.
+func (o *options) call(ctx context.Context, key string, code codes.Code, call func() error) error {
+	b := o.registry.Get(key)
+
+	allower, ok := b.(breaker.Allower)
+	if !ok {
+		rejected, err := o.do(ctx, b, call)
+		if rejected != nil {
+			return &rejectedError{err: rejected, code: code}
+		}
+		return err
+	}
+
+	done, err := allower.AllowContext(ctx)
+	if err != nil {
+		return notAllowed(err, code)
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			done(breaker.OutcomeFailure, fmt.Errorf("breakergrpc: call panicked: %v", v))
+			panic(v)
+		}
+	}()
+
+	err = call()
+	done(o.outcome(ctx, err), err)
+
+	return err
+}
+
+// do makes call through a breaker that is not a breaker.Allower, and so
+// cannot report an outcome other than by the error of Do: an ignored call
+// is recorded as a success. It returns the rejection of b, if any, and
+// the error of call.
+func (o *options) do(ctx context.Context, b breaker.Breaker, call func() error) (rejected, err error) {
+	rejected = b.Do(func() error {
+		err = call()
+		if o.outcome(ctx, err) == breaker.OutcomeFailure {
+			return errFailure
+		}
+		return nil
+	})
+	if errors.Is(rejected, errFailure) {
+		rejected = nil
+	}
+	return rejected, err
+}
+
+// errFailure reports a failed call to a breaker.
+var errFailure = errors.New("breakergrpc: call failed")
+
+// notAllowed returns the error of a call AllowContext did not let
+// through: a rejection of the breaker, with a status of code, or the
+// status of the done context of the call.
+func notAllowed(err error, code codes.Code) error {
+	if !errors.Is(err, breaker.ErrServiceUnavailable) {
+		return status.FromContextError(err).Err()
+	}
+	return &rejectedError{err: err, code: code}
+}
+
+// rejectedError is a rejection of a breaker, with a gRPC status of code.
+// It matches breaker.ErrServiceUnavailable with errors.Is.
+type rejectedError struct {
+	err  error
+	code codes.Code
+}
+
+func (e *rejectedError) Error() string { return e.err.Error() }
+
+func (e *rejectedError) Unwrap() error { return e.err }
+
+// GRPCStatus returns the status of the rejection, with a RetryInfo detail
+// if the breaker gave a hint of when to retry.
+func (e *rejectedError) GRPCStatus() *status.Status {
+	s := status.New(e.code, e.err.Error())
+
+	var rejected *breaker.RejectedError
+	if !errors.As(e.err, &rejected) || rejected.RetryAfter <= 0 {
+		return s
+	}
+
+	detailed, err := s.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(rejected.RetryAfter)})
+	if err != nil {
+		return s
+	}
+	return detailed
+}
@@ -0,0 +1,138 @@
+package breakergrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/chenyanchen/breaker"
+)
+
+// UnaryClientInterceptor returns an interceptor that sends unary calls
+// through one breaker per method, or per key, see WithKey. A rejected
+// call fails with codes.Unavailable, and its error matches
+// breaker.ErrServiceUnavailable with errors.Is. A call is throttled by
+// the criticality carried by its context, see
+// breaker.ContextWithCriticality.
+func UnaryClientInterceptor(opts ...Option) grpc.UnaryClientInterceptor {
+	o := newOptions(opts)
+
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		return o.call(ctx, o.key(cc.Target(), method), codes.Unavailable, func() error {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		})
+	}
+}
+
+// StreamClientInterceptor returns an interceptor that sends streams
+// through one breaker per method, or per key, see WithKey. A rejected
+// stream fails with codes.Unavailable, and its error matches
+// breaker.ErrServiceUnavailable with errors.Is.
+//
+// The outcome of a stream is recorded once its status is known: when
+// RecvMsg returns it, when SendMsg, Header or CloseSend fail, or when the
+// context of the stream is done. A stream canceled by the caller is not
+// recorded, so like gRPC requires, a stream must be received from until
+// it ends, or canceled. With a breaker that is not a breaker.Allower, only
+// the creation of the stream is recorded.
+func StreamClientInterceptor(opts ...Option) grpc.StreamClientInterceptor {
+	o := newOptions(opts)
+
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		b := o.registry.Get(o.key(cc.Target(), method))
+
+		allower, ok := b.(breaker.Allower)
+		if !ok {
+			var cs grpc.ClientStream
+			rejected, err := o.do(ctx, b, func() (err error) {
+				cs, err = streamer(ctx, desc, cc, method, callOpts...)
+				return err
+			})
+			if rejected != nil {
+				return nil, &rejectedError{err: rejected, code: codes.Unavailable}
+			}
+			return cs, err
+		}
+
+		done, err := allower.AllowContext(ctx)
+		if err != nil {
+			return nil, notAllowed(err, codes.Unavailable)
+		}
+
+		cs, err := streamer(ctx, desc, cc, method, callOpts...)
+		if err != nil {
+			done(o.outcome(ctx, err), err)
+			return nil, err
+		}
+
+		// The stream ends with its context, even if it is not received from.
+		stop := context.AfterFunc(ctx, func() {
+			err := status.FromContextError(ctx.Err()).Err()
+			done(o.outcome(ctx, err), err)
+		})
+
+		return &clientStream{
+			ClientStream:  cs,
+			serverStreams: desc.ServerStreams,
+			done: func(err error) {
+				stop()
+				done(o.outcome(ctx, err), err)
+			},
+		}, nil
+	}
+}
+
+// clientStream reports the outcome of a stream once its status is known,
+// only the first report is recorded.
+type clientStream struct {
+	grpc.ClientStream
+
+	serverStreams bool
+	done          func(error)
+}
+
+// SendMsg reports the error of a failed stream. An io.EOF means the stream
+// has ended, RecvMsg returns its status.
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	s.fail(err)
+	return err
+}
+
+func (s *clientStream) Header() (metadata.MD, error) {
+	md, err := s.ClientStream.Header()
+	s.fail(err)
+	return md, err
+}
+
+func (s *clientStream) CloseSend() error {
+	err := s.ClientStream.CloseSend()
+	s.fail(err)
+	return err
+}
+
+// fail reports err, unless it is nil or io.EOF.
+func (s *clientStream) fail(err error) {
+	if err != nil && !errors.Is(err, io.EOF) {
+		s.done(err)
+	}
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.done(nil)
+	case err != nil:
+		s.done(err)
+	case !s.serverStreams:
+		// The only response of a client streaming call ends it.
+		s.done(nil)
+	}
+	return err
+}
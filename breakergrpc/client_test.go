@@ -0,0 +1,366 @@
+package breakergrpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/chenyanchen/breaker"
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+// healthServer fails the calls whose service is a status code, e.g. "14"
+// for Unavailable.
+type healthServer struct {
+	grpc_health_v1.UnimplementedHealthServer
+}
+
+func (s *healthServer) Check(_ context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
+	if err := statusOf(req.GetService()); err != nil {
+		return nil, err
+	}
+	return &grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING}, nil
+}
+
+func (s *healthServer) Watch(req *grpc_health_v1.HealthCheckRequest, stream grpc_health_v1.Health_WatchServer) error {
+	if err := statusOf(req.GetService()); err != nil {
+		return err
+	}
+	return stream.Send(&grpc_health_v1.HealthCheckResponse{Status: grpc_health_v1.HealthCheckResponse_SERVING})
+}
+
+func statusOf(service string) error {
+	code, err := strconv.Atoi(service)
+	if err != nil || code == 0 {
+		return nil
+	}
+	return status.Error(codes.Code(code), "test error")
+}
+
+// newTestClient returns a health client of an in-process server.
+func newTestClient(t *testing.T, serverOpts []grpc.ServerOption, dialOpts ...grpc.DialOption) grpc_health_v1.HealthClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer(serverOpts...)
+	grpc_health_v1.RegisterHealthServer(srv, &healthServer{})
+	go func() { _ = srv.Serve(lis) }()
+	t.Cleanup(srv.Stop)
+
+	dialOpts = append(dialOpts,
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	conn, err := grpc.NewClient("passthrough:///bufnet", dialOpts...)
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return grpc_health_v1.NewHealthClient(conn)
+}
+
+// newTestRegistry returns a registry whose breakers drop as soon as the
+// drop ratio is above 0.
+func newTestRegistry(tb testing.TB, opts ...breaker.RegistryOption) *breaker.Registry {
+	tb.Helper()
+	opts = append([]breaker.RegistryOption{breaker.WithDefaultOptions(breaker.WithRandSource(breakertest.NewSource(0)))}, opts...)
+	registry, err := breaker.NewRegistry(opts...)
+	if err != nil {
+		tb.Fatalf("NewRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func check(client grpc_health_v1.HealthClient, code codes.Code) error {
+	_, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: strconv.Itoa(int(code))})
+	return err
+}
+
+func watch(client grpc_health_v1.HealthClient, code codes.Code) error {
+	stream, err := client.Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{Service: strconv.Itoa(int(code))})
+	if err != nil {
+		return err
+	}
+	for {
+		if _, err = stream.Recv(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		opts         []Option
+		code         codes.Code
+		wantRejected bool
+	}{
+		{name: "ok", code: codes.OK, wantRejected: false},
+		{name: "not found is a success", code: codes.NotFound, wantRejected: false},
+		{name: "unavailable", code: codes.Unavailable, wantRejected: true},
+		{name: "deadline exceeded", code: codes.DeadlineExceeded, wantRejected: true},
+		{name: "resource exhausted", code: codes.ResourceExhausted, wantRejected: true},
+		{
+			name:         "custom failure code",
+			opts:         []Option{WithFailureCodes(codes.Internal)},
+			code:         codes.Internal,
+			wantRejected: true,
+		}, {
+			name:         "custom failure codes replace the defaults",
+			opts:         []Option{WithFailureCodes(codes.Internal)},
+			code:         codes.Unavailable,
+			wantRejected: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := append([]Option{WithRegistry(newTestRegistry(t))}, tt.opts...)
+			client := newTestClient(t, nil, grpc.WithUnaryInterceptor(UnaryClientInterceptor(opts...)))
+
+			if err := check(client, tt.code); status.Code(err) != tt.code {
+				t.Fatalf("Check() error = %v, want code %v", err, tt.code)
+			}
+
+			err := check(client, codes.OK)
+			if rejected := errors.Is(err, breaker.ErrServiceUnavailable); rejected != tt.wantRejected {
+				t.Errorf("Check() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+			if tt.wantRejected && status.Code(err) != codes.Unavailable {
+				t.Errorf("Check() code = %v, want %v", status.Code(err), codes.Unavailable)
+			}
+			var rejected *breaker.RejectedError
+			if errors.As(err, &rejected) && status.Code(rejected.Cause) != tt.code {
+				t.Errorf("RejectedError.Cause = %v, want code %v", rejected.Cause, tt.code)
+			}
+		})
+	}
+}
+
+func TestUnaryClientInterceptor_retryInfo(t *testing.T) {
+	client := newTestClient(t, nil, grpc.WithUnaryInterceptor(UnaryClientInterceptor(WithRegistry(newTestRegistry(t)))))
+	_ = check(client, codes.Unavailable)
+
+	s := status.Convert(check(client, codes.OK))
+	var retryInfo *errdetails.RetryInfo
+	for _, detail := range s.Details() {
+		if d, ok := detail.(*errdetails.RetryInfo); ok {
+			retryInfo = d
+		}
+	}
+	// The default bucket interval is 500ms.
+	if retryInfo == nil || retryInfo.GetRetryDelay().AsDuration().Milliseconds() != 500 {
+		t.Errorf("Details() = %v, want a RetryInfo of 500ms", s.Details())
+	}
+}
+
+func TestUnaryClientInterceptor_callerCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	client := newTestClient(t, nil, grpc.WithChainUnaryInterceptor(
+		UnaryClientInterceptor(WithRegistry(newTestRegistry(t)), WithFailureCodes(codes.Canceled)),
+		// The caller gives up after the breaker admitted the call.
+		func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+			cancel()
+			return invoker(ctx, method, req, reply, cc, opts...)
+		},
+	))
+
+	if _, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}); status.Code(err) != codes.Canceled {
+		t.Fatalf("Check() error = %v, want code %v", err, codes.Canceled)
+	}
+
+	if err := check(client, codes.OK); err != nil {
+		t.Errorf("Check() error = %v, the canceled call was recorded as a failure", err)
+	}
+}
+
+func TestStreamClientInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         codes.Code
+		wantRejected bool
+	}{
+		{name: "ok", code: codes.OK, wantRejected: false},
+		{name: "not found is a success", code: codes.NotFound, wantRejected: false},
+		{name: "unavailable", code: codes.Unavailable, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, nil, grpc.WithStreamInterceptor(StreamClientInterceptor(WithRegistry(newTestRegistry(t)))))
+
+			if err := watch(client, tt.code); status.Code(err) != tt.code {
+				t.Fatalf("Watch() error = %v, want code %v", err, tt.code)
+			}
+
+			err := watch(client, codes.OK)
+			if rejected := errors.Is(err, breaker.ErrServiceUnavailable); rejected != tt.wantRejected {
+				t.Errorf("Watch() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestStreamClientInterceptor_canceled(t *testing.T) {
+	b := breaker.NewGoogleBreaker(breaker.WithRandSource(breakertest.NewSource(0)))
+	reports := make(chan breaker.Outcome, 20)
+	registry := newTestRegistry(t, breaker.WithFactory(func(string) breaker.Breaker {
+		return allowerFunc{Breaker: b, allow: func(ctx context.Context) (func(breaker.Outcome, error), error) {
+			done, err := b.AllowContext(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return func(outcome breaker.Outcome, err error) {
+				done(outcome, err)
+				reports <- outcome
+			}, nil
+		}}
+	}))
+	client := newTestClient(t, nil, grpc.WithStreamInterceptor(StreamClientInterceptor(WithRegistry(registry))))
+
+	// The streams are healthy, but canceled before they end.
+	for range 10 {
+		ctx, cancel := context.WithCancel(context.Background())
+		stream, err := client.Watch(ctx, &grpc_health_v1.HealthCheckRequest{})
+		if err != nil {
+			t.Fatalf("Watch() error = %v", err)
+		}
+		if _, err = stream.Recv(); err != nil {
+			t.Fatalf("Recv() error = %v", err)
+		}
+		cancel()
+
+		if outcome := <-reports; outcome != breaker.OutcomeIgnored {
+			t.Errorf("canceled stream reported %v, want %v", outcome, breaker.OutcomeIgnored)
+		}
+	}
+
+	if stats := b.Stats(); stats.Requests != 0 {
+		t.Errorf("Stats() = %+v, want the canceled streams not recorded", stats)
+	}
+	if err := watch(client, codes.OK); err != nil {
+		t.Errorf("Watch() error = %v, want nil", err)
+	}
+}
+
+// allowerFunc is a breaker.Allower whose AllowContext is allow.
+type allowerFunc struct {
+	breaker.Breaker
+
+	allow func(context.Context) (func(breaker.Outcome, error), error)
+}
+
+func (a allowerFunc) Allow() (func(breaker.Outcome, error), error) {
+	return a.allow(context.Background())
+}
+
+func (a allowerFunc) AllowContext(ctx context.Context) (func(breaker.Outcome, error), error) {
+	return a.allow(ctx)
+}
+
+// failingStream is a ClientStream whose sends fail with err.
+type failingStream struct {
+	grpc.ClientStream
+
+	err error
+}
+
+func (s failingStream) SendMsg(any) error            { return s.err }
+func (s failingStream) Header() (metadata.MD, error) { return nil, s.err }
+func (s failingStream) CloseSend() error             { return s.err }
+
+func Test_clientStream_report(t *testing.T) {
+	calls := map[string]func(s *clientStream) error{
+		"SendMsg":   func(s *clientStream) error { return s.SendMsg(nil) },
+		"Header":    func(s *clientStream) error { _, err := s.Header(); return err },
+		"CloseSend": func(s *clientStream) error { return s.CloseSend() },
+	}
+	errUnavailable := status.Error(codes.Unavailable, "test error")
+	for name, call := range calls {
+		for _, tt := range []struct {
+			err        error
+			wantReport error
+		}{
+			{err: nil, wantReport: nil},
+			{err: io.EOF, wantReport: nil},
+			{err: errUnavailable, wantReport: errUnavailable},
+		} {
+			var reported error
+			s := &clientStream{
+				ClientStream: failingStream{err: tt.err},
+				done:         func(err error) { reported = err },
+			}
+			if err := call(s); !errors.Is(err, tt.err) {
+				t.Errorf("%s() error = %v, want %v", name, err, tt.err)
+			}
+			if !errors.Is(reported, tt.wantReport) {
+				t.Errorf("%s() with error %v reported %v, want %v", name, tt.err, reported, tt.wantReport)
+			}
+		}
+	}
+}
+
+func TestClientInterceptors_key(t *testing.T) {
+	tests := []struct {
+		name         string
+		key          func(target, method string) string
+		wantRejected bool
+	}{
+		{name: "per method", key: MethodKey, wantRejected: false},
+		{name: "per target", key: TargetKey, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{WithRegistry(newTestRegistry(t)), WithKey(tt.key)}
+			client := newTestClient(t, nil,
+				grpc.WithUnaryInterceptor(UnaryClientInterceptor(opts...)),
+				grpc.WithStreamInterceptor(StreamClientInterceptor(opts...)),
+			)
+
+			_ = check(client, codes.Unavailable)
+
+			err := watch(client, codes.OK)
+			if rejected := errors.Is(err, breaker.ErrServiceUnavailable); rejected != tt.wantRejected {
+				t.Errorf("Watch() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+// plainBreaker implements Breaker but not Allower.
+type plainBreaker struct {
+	breaker.Breaker
+}
+
+func TestClientInterceptors_plainBreaker(t *testing.T) {
+	registry := newTestRegistry(t, breaker.WithFactory(func(string) breaker.Breaker {
+		return plainBreaker{breaker.NewGoogleBreaker(breaker.WithRandSource(breakertest.NewSource(0)))}
+	}))
+	client := newTestClient(t, nil,
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(WithRegistry(registry))),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(WithRegistry(registry))),
+	)
+
+	if err := check(client, codes.Unavailable); status.Code(err) != codes.Unavailable {
+		t.Fatalf("Check() error = %v, want code %v", err, codes.Unavailable)
+	}
+	if err := check(client, codes.OK); !errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Errorf("Check() error = %v, want %v", err, breaker.ErrServiceUnavailable)
+	}
+	if err := watch(client, codes.OK); err != nil {
+		t.Errorf("Watch() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,16 @@
+module github.com/chenyanchen/breaker/breakergrpc
+
+go 1.24.0
+
+require (
+	github.com/chenyanchen/breaker v0.0.1
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20250218202821-56aae31c358a
+	google.golang.org/grpc v1.72.2
+	google.golang.org/protobuf v1.36.5
+)
+
+require (
+	golang.org/x/net v0.35.0 // indirect
+	golang.org/x/sys v0.30.0 // indirect
+	golang.org/x/text v0.22.0 // indirect
+)
@@ -0,0 +1,41 @@
+package breakergrpc
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// UnaryServerInterceptor returns an interceptor that sheds load: it
+// admits calls through one breaker per method, or per key with an empty
+// target, see WithKey, and records the status codes returned by the
+// handlers. A rejected call fails with codes.ResourceExhausted before its
+// handler runs. A call is throttled by the criticality carried by its
+// context, e.g. set by an earlier interceptor.
+//
+// A panic of a handler is recorded as a failure, and a call canceled by
+// the client is not recorded.
+func UnaryServerInterceptor(opts ...Option) grpc.UnaryServerInterceptor {
+	o := newOptions(opts)
+
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp any, err error) {
+		err = o.call(ctx, o.key("", info.FullMethod), codes.ResourceExhausted, func() (err error) {
+			resp, err = handler(ctx, req)
+			return err
+		})
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor is like UnaryServerInterceptor, for streams. The
+// outcome of a stream is the status returned by its handler.
+func StreamServerInterceptor(opts ...Option) grpc.StreamServerInterceptor {
+	o := newOptions(opts)
+
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		return o.call(ss.Context(), o.key("", info.FullMethod), codes.ResourceExhausted, func() error {
+			return handler(srv, ss)
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package breakergrpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/chenyanchen/breaker"
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         codes.Code
+		wantRejected bool
+	}{
+		{name: "ok", code: codes.OK, wantRejected: false},
+		{name: "invalid argument is a success", code: codes.InvalidArgument, wantRejected: false},
+		{name: "unavailable", code: codes.Unavailable, wantRejected: true},
+		{name: "resource exhausted", code: codes.ResourceExhausted, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, []grpc.ServerOption{
+				grpc.UnaryInterceptor(UnaryServerInterceptor(WithRegistry(newTestRegistry(t)))),
+			})
+
+			if err := check(client, tt.code); status.Code(err) != tt.code {
+				t.Fatalf("Check() error = %v, want code %v", err, tt.code)
+			}
+
+			err := check(client, codes.OK)
+			if rejected := status.Code(err) == codes.ResourceExhausted; rejected != tt.wantRejected {
+				t.Errorf("Check() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	tests := []struct {
+		name         string
+		code         codes.Code
+		wantRejected bool
+	}{
+		{name: "ok", code: codes.OK, wantRejected: false},
+		{name: "not found is a success", code: codes.NotFound, wantRejected: false},
+		{name: "deadline exceeded", code: codes.DeadlineExceeded, wantRejected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newTestClient(t, []grpc.ServerOption{
+				grpc.StreamInterceptor(StreamServerInterceptor(WithRegistry(newTestRegistry(t)))),
+			})
+
+			if err := watch(client, tt.code); status.Code(err) != tt.code {
+				t.Fatalf("Watch() error = %v, want code %v", err, tt.code)
+			}
+
+			err := watch(client, codes.OK)
+			if rejected := status.Code(err) == codes.ResourceExhausted; rejected != tt.wantRejected {
+				t.Errorf("Watch() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor_rejectBeforeHandler(t *testing.T) {
+	interceptor := UnaryServerInterceptor(WithRegistry(newTestRegistry(t)))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	calls := 0
+	handler := func(context.Context, any) (any, error) {
+		calls++
+		return nil, status.Error(codes.Unavailable, "test error")
+	}
+	_, _ = interceptor(context.Background(), nil, info, handler)
+
+	_, err := interceptor(context.Background(), nil, info, handler)
+	if !errors.Is(err, breaker.ErrServiceUnavailable) || status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("interceptor() error = %v, want %v with code %v", err, breaker.ErrServiceUnavailable, codes.ResourceExhausted)
+	}
+	if calls != 1 {
+		t.Errorf("handler called %d times, want 1", calls)
+	}
+}
+
+func TestUnaryServerInterceptor_panic(t *testing.T) {
+	interceptor := UnaryServerInterceptor(WithRegistry(newTestRegistry(t)))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recover() = %v, want boom", v)
+			}
+		}()
+		_, _ = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+			panic("boom")
+		})
+	}()
+
+	_, err := interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) { return nil, nil })
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("interceptor() error = %v, want code %v", err, codes.ResourceExhausted)
+	}
+}
+
+func TestUnaryServerInterceptor_criticality(t *testing.T) {
+	// (2 - 1.5*1) / (2 + 1) is 1/6, and 1/3 for Sheddable.
+	registry := newTestRegistry(t, breaker.WithDefaultOptions(breaker.WithRandSource(breakertest.NewSource(0.25))))
+	interceptor := UnaryServerInterceptor(WithRegistry(registry))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+	ok := func(context.Context, any) (any, error) { return nil, nil }
+	_, _ = interceptor(context.Background(), nil, info, ok)
+	_, _ = interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return nil, status.Error(codes.Unavailable, "test error")
+	})
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	steps := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{name: "sheddable", ctx: breaker.ContextWithCriticality(context.Background(), breaker.Sheddable), wantCode: codes.ResourceExhausted},
+		{name: "critical", ctx: breaker.ContextWithCriticality(context.Background(), breaker.Critical), wantCode: codes.OK},
+		{name: "canceled", ctx: canceled, wantCode: codes.Canceled},
+	}
+	for _, step := range steps {
+		if _, err := interceptor(step.ctx, nil, info, ok); status.Code(err) != step.wantCode {
+			t.Errorf("%s: interceptor() error = %v, want code %v", step.name, err, step.wantCode)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor_clientCanceled(t *testing.T) {
+	interceptor := UnaryServerInterceptor(WithRegistry(newTestRegistry(t)))
+	info := &grpc.UnaryServerInfo{FullMethod: "/test.Service/Method"}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, _ = interceptor(ctx, nil, info, func(context.Context, any) (any, error) {
+		cancel()
+		return nil, status.Error(codes.Unavailable, "test error")
+	})
+
+	_, err := interceptor(context.Background(), nil, info, func(context.Context, any) (any, error) { return nil, nil })
+	if err != nil {
+		t.Errorf("interceptor() error = %v, the canceled call was recorded as a failure", err)
+	}
+}
@@ -0,0 +1,208 @@
+package breakerhttp
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/chenyanchen/breaker"
+)
+
+// Handler is an http.Handler middleware that sheds load: it admits
+// requests through one breaker per route, see WithRouteKey, and records
+// the responses of the next handler.
+type Handler struct {
+	next     http.Handler
+	registry *breaker.Registry
+	key      func(*http.Request) string
+	classify func(code int) breaker.Outcome
+}
+
+type HandlerOption func(*Handler)
+
+// WithHandlerRegistry sets the registry the breakers are looked up in, it
+// defaults to breaker.NewRegistry().
+func WithHandlerRegistry(r *breaker.Registry) HandlerOption {
+	return func(h *Handler) { h.registry = r }
+}
+
+// WithRouteKey sets the name of the breaker of a request. It defaults to
+// r.Pattern, which is only set when the Handler is registered in an
+// http.ServeMux, use PatternKey to wrap the ServeMux itself.
+func WithRouteKey(key func(*http.Request) string) HandlerOption {
+	return func(h *Handler) { h.key = key }
+}
+
+// WithStatusClassifier sets how the status codes of the responses are
+// recorded, it defaults to ClassifyStatus.
+func WithStatusClassifier(classify func(code int) breaker.Outcome) HandlerOption {
+	return func(h *Handler) { h.classify = classify }
+}
+
+// NewHandler returns a Handler that serves the admitted requests with
+// next, and rejects the others with 503 Service Unavailable.
+func NewHandler(next http.Handler, opts ...HandlerOption) *Handler {
+	h := &Handler{
+		next:     next,
+		key:      func(r *http.Request) string { return r.Pattern },
+		classify: ClassifyStatus,
+	}
+
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	if h.registry == nil {
+		// A registry without options is always valid.
+		h.registry, _ = breaker.NewRegistry()
+	}
+
+	return h
+}
+
+// PatternKey returns a route key of the pattern mux routes the request
+// to, so that a Handler wrapping mux keeps one breaker per route.
+func PatternKey(mux *http.ServeMux) func(*http.Request) string {
+	return func(r *http.Request) string {
+		_, pattern := mux.Handler(r)
+		return pattern
+	}
+}
+
+// ServeHTTP implements http.Handler.
+//
+// A request is throttled by the criticality carried by its context, e.g.
+// set by a middleware wrapping the Handler. A panic of the next handler
+// is recorded as a failure, and a request whose context is canceled by
+// the client is not recorded.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := h.registry.Get(h.key(r))
+
+	allower, ok := b.(breaker.Allower)
+	if !ok {
+		h.do(b, w, r)
+		return
+	}
+
+	done, err := allower.AllowContext(r.Context())
+	if err != nil {
+		reject(w, err)
+		return
+	}
+
+	rw := &responseWriter{ResponseWriter: w}
+	defer func() {
+		if v := recover(); v != nil {
+			done(breaker.OutcomeFailure, fmt.Errorf("breakerhttp: handler panicked: %v", v))
+			panic(v)
+		}
+	}()
+
+	h.next.ServeHTTP(rw, r)
+	if outcome := h.outcome(r, rw); outcome == breaker.OutcomeFailure {
+		done(outcome, statusError(rw.status()))
+	} else {
+		done(outcome, nil)
+	}
+}
+
+// do serves r through a breaker that cannot report an outcome other than
+// by the error of Do, so an ignored request is recorded as a success.
+func (h *Handler) do(b breaker.Breaker, w http.ResponseWriter, r *http.Request) {
+	err := b.Do(func() error {
+		rw := &responseWriter{ResponseWriter: w}
+		h.next.ServeHTTP(rw, r)
+		if h.outcome(r, rw) == breaker.OutcomeFailure {
+			return errFailure
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errFailure) {
+		reject(w, err)
+	}
+}
+
+func (h *Handler) outcome(r *http.Request, rw *responseWriter) breaker.Outcome {
+	if errors.Is(r.Context().Err(), context.Canceled) {
+		// The client gave up, the server is not to blame.
+		return breaker.OutcomeIgnored
+	}
+	return h.classify(rw.status())
+}
+
+// reject responds to a rejected request with 503 Service Unavailable. The
+// error is not sent, it names the breaker and its last failure.
+func reject(w http.ResponseWriter, err error) {
+	setRetryAfter(w.Header(), err)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+// responseWriter records the status code written by a handler.
+type responseWriter struct {
+	http.ResponseWriter
+
+	code int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	// Informational responses are followed by the final one.
+	if w.code == 0 && code >= http.StatusOK {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *responseWriter) Flush() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// ReadFrom implements io.ReaderFrom, so that io.Copy keeps using the
+// ReadFrom of the wrapped ResponseWriter, e.g. sendfile.
+func (w *responseWriter) ReadFrom(r io.Reader) (int64, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return io.Copy(w.ResponseWriter, r)
+}
+
+// Hijack implements http.Hijacker, e.g. for WebSockets. It fails with
+// http.ErrNotSupported if the wrapped ResponseWriter is not a Hijacker,
+// such as the one of HTTP/2. The status of a hijacked request is the one
+// written before Hijack, 200 OK if none.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the wrapped ResponseWriter, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// status returns the status code of the response, a handler that wrote
+// nothing responds with 200 OK.
+func (w *responseWriter) status() int {
+	if w.code == 0 {
+		return http.StatusOK
+	}
+	return w.code
+}
@@ -0,0 +1,282 @@
+package breakerhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/chenyanchen/breaker"
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+// statusHandler responds with code.
+func statusHandler(code int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(code)
+	})
+}
+
+func serve(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestHandler_ServeHTTP(t *testing.T) {
+	tests := []struct {
+		name         string
+		next         http.Handler
+		wantRejected bool
+	}{
+		{
+			name:         "success",
+			next:         statusHandler(http.StatusOK),
+			wantRejected: false,
+		}, {
+			name:         "empty response is a success",
+			next:         http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}),
+			wantRejected: false,
+		}, {
+			name:         "client error is a success",
+			next:         statusHandler(http.StatusBadRequest),
+			wantRejected: false,
+		}, {
+			name:         "server error is a failure",
+			next:         statusHandler(http.StatusInternalServerError),
+			wantRejected: true,
+		}, {
+			name:         "too many requests is a failure",
+			next:         statusHandler(http.StatusTooManyRequests),
+			wantRejected: true,
+		}, {
+			name: "informational status is not final",
+			next: http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusEarlyHints)
+				w.WriteHeader(http.StatusBadGateway)
+			}),
+			wantRejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHandler(tt.next, WithHandlerRegistry(newTestRegistry(t)))
+			serve(h, "/")
+
+			w := serve(h, "/")
+			if rejected := w.Code == http.StatusServiceUnavailable; rejected != tt.wantRejected {
+				t.Errorf("Code = %d, wantRejected %v", w.Code, tt.wantRejected)
+			}
+		})
+	}
+}
+
+func TestHandler_ServeHTTP_reject(t *testing.T) {
+	calls := 0
+	registry := newTestRegistry(t)
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusInternalServerError)
+	}), WithHandlerRegistry(registry))
+	serve(h, "/")
+
+	w := serve(h, "/")
+	if w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+	if got, want := w.Body.String(), "Service Unavailable\n"; got != want {
+		t.Errorf("Body = %q, want %q", got, want)
+	}
+	// The default bucket interval is 500ms.
+	if got := w.Header().Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+	if calls != 1 {
+		t.Errorf("next handler called %d times, want 1", calls)
+	}
+
+	// The route key of a request not routed by a ServeMux is empty.
+	var rejected *breaker.RejectedError
+	if err := registry.Get("").Do(func() error { return nil }); !errors.As(err, &rejected) ||
+		rejected.Cause == nil || rejected.Cause.Error() != "breakerhttp: status 500 Internal Server Error" {
+		t.Errorf("Do() error = %v, want a *breaker.RejectedError caused by the status 500", err)
+	}
+}
+
+func TestHandler_ServeHTTP_panic(t *testing.T) {
+	h := NewHandler(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic("boom")
+	}), WithHandlerRegistry(newTestRegistry(t)))
+
+	func() {
+		defer func() {
+			if v := recover(); v != "boom" {
+				t.Errorf("recover() = %v, want boom", v)
+			}
+		}()
+		serve(h, "/")
+	}()
+
+	if w := serve(h, "/"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestHandler_ServeHTTP_clientCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	h := NewHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusInternalServerError)
+	}), WithHandlerRegistry(newTestRegistry(t)))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequestWithContext(ctx, http.MethodGet, "/", nil))
+
+	if w := serve(h, "/"); w.Code == http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, the canceled request was recorded as a failure", w.Code)
+	}
+}
+
+func TestHandler_ServeHTTP_perRoute(t *testing.T) {
+	tests := []struct {
+		name string
+		wrap func(mux *http.ServeMux) http.Handler
+	}{
+		{
+			name: "registered in the mux",
+			wrap: func(*http.ServeMux) http.Handler {
+				registry := newTestRegistry(t)
+				mux := http.NewServeMux()
+				mux.Handle("/failing/", NewHandler(statusHandler(http.StatusInternalServerError), WithHandlerRegistry(registry)))
+				mux.Handle("/healthy/", NewHandler(statusHandler(http.StatusOK), WithHandlerRegistry(registry)))
+				return mux
+			},
+		}, {
+			name: "wrapping the mux",
+			wrap: func(mux *http.ServeMux) http.Handler {
+				mux.Handle("/failing/", statusHandler(http.StatusInternalServerError))
+				mux.Handle("/healthy/", statusHandler(http.StatusOK))
+				return NewHandler(mux, WithHandlerRegistry(newTestRegistry(t)), WithRouteKey(PatternKey(mux)))
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := tt.wrap(http.NewServeMux())
+			serve(h, "/failing/1")
+
+			if w := serve(h, "/failing/2"); w.Code != http.StatusServiceUnavailable {
+				t.Errorf("Code of /failing/2 = %d, want %d", w.Code, http.StatusServiceUnavailable)
+			}
+			if w := serve(h, "/healthy/1"); w.Code != http.StatusOK {
+				t.Errorf("Code of /healthy/1 = %d, want %d", w.Code, http.StatusOK)
+			}
+		})
+	}
+}
+
+func Test_responseWriter_Unwrap(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: recorder}
+
+	if err := http.NewResponseController(rw).Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if !recorder.Flushed {
+		t.Errorf("Flushed = false, want true")
+	}
+	if rw.status() != http.StatusOK {
+		t.Errorf("status() = %d, want %d", rw.status(), http.StatusOK)
+	}
+}
+
+func Test_responseWriter_ReadFrom(t *testing.T) {
+	recorder := httptest.NewRecorder()
+	rw := &responseWriter{ResponseWriter: recorder}
+
+	if n, err := io.Copy(rw, strings.NewReader("hello")); n != 5 || err != nil {
+		t.Fatalf("Copy() = (%d, %v), want (5, nil)", n, err)
+	}
+	if got := recorder.Body.String(); got != "hello" {
+		t.Errorf("Body = %q, want %q", got, "hello")
+	}
+	if rw.status() != http.StatusOK {
+		t.Errorf("status() = %d, want %d", rw.status(), http.StatusOK)
+	}
+}
+
+func Test_responseWriter_Hijack(t *testing.T) {
+	if _, _, err := (&responseWriter{ResponseWriter: httptest.NewRecorder()}).Hijack(); !errors.Is(err, http.ErrNotSupported) {
+		t.Errorf("Hijack() error = %v, want %v", err, http.ErrNotSupported)
+	}
+
+	srv := httptest.NewServer(NewHandler(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		// WebSocket libraries assert the interface, not all of them use
+		// http.ResponseController.
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("ResponseWriter is not a http.Hijacker")
+			return
+		}
+		conn, buf, err := h.Hijack()
+		if err != nil {
+			t.Errorf("Hijack() error = %v", err)
+			return
+		}
+		defer conn.Close()
+		_, _ = buf.WriteString("HTTP/1.1 200 OK\r\nContent-Length: 8\r\nConnection: close\r\n\r\nhijacked")
+		_ = buf.Flush()
+	}), WithHandlerRegistry(newTestRegistry(t))))
+	t.Cleanup(srv.Close)
+
+	resp, err := get(t, srv.Client(), srv.URL)
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+}
+
+func TestHandler_ServeHTTP_criticality(t *testing.T) {
+	// (2 - 1.5*1) / (2 + 1) is 1/6, and 1/3 for Sheddable.
+	registry := newTestRegistry(t, breaker.WithDefaultOptions(breaker.WithRandSource(breakertest.NewSource(0.25))))
+	mux := http.NewServeMux()
+	mux.Handle("/ok", statusHandler(http.StatusOK))
+	mux.Handle("/error", statusHandler(http.StatusInternalServerError))
+	h := NewHandler(mux, WithHandlerRegistry(registry), WithRouteKey(func(*http.Request) string { return "" }))
+	serve(h, "/ok")
+	serve(h, "/error")
+
+	for _, tt := range []struct {
+		criticality breaker.Criticality
+		wantCode    int
+	}{
+		{criticality: breaker.Sheddable, wantCode: http.StatusServiceUnavailable},
+		{criticality: breaker.Critical, wantCode: http.StatusOK},
+	} {
+		r := httptest.NewRequest(http.MethodGet, "/ok", nil)
+		r = r.WithContext(breaker.ContextWithCriticality(r.Context(), tt.criticality))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("%v: Code = %d, want %d", tt.criticality, w.Code, tt.wantCode)
+		}
+	}
+}
+
+func TestHandler_ServeHTTP_plainBreaker(t *testing.T) {
+	registry := newTestRegistry(t, breaker.WithFactory(func(string) breaker.Breaker {
+		return plainBreaker{breaker.NewGoogleBreaker(breaker.WithRandSource(breakertest.NewSource(0)))}
+	}))
+	h := NewHandler(statusHandler(http.StatusInternalServerError), WithHandlerRegistry(registry))
+
+	if w := serve(h, "/"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Code = %d, want %d", w.Code, http.StatusInternalServerError)
+	}
+	if w := serve(h, "/"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("Code = %d, want %d", w.Code, http.StatusServiceUnavailable)
+	}
+}
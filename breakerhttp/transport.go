@@ -0,0 +1,209 @@
+// Package breakerhttp protects net/http clients and servers with circuit
+// breakers.
+package breakerhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/chenyanchen/breaker"
+)
+
+// Transport is an http.RoundTripper that sends requests through one
+// breaker per host, or per key, see WithKey.
+type Transport struct {
+	base     http.RoundTripper
+	registry *breaker.Registry
+	key      func(*http.Request) string
+	classify func(*http.Response, error) breaker.Outcome
+
+	rejectWithResponse bool
+}
+
+type Option func(*Transport)
+
+// WithRegistry sets the registry the breakers are looked up in, it
+// defaults to breaker.NewRegistry().
+func WithRegistry(r *breaker.Registry) Option {
+	return func(t *Transport) { t.registry = r }
+}
+
+// WithKey sets the name of the breaker of a request, it defaults to
+// req.URL.Host.
+func WithKey(key func(*http.Request) string) Option {
+	return func(t *Transport) { t.key = key }
+}
+
+// WithClassifier sets how the round trips are recorded, it defaults to
+// ClassifyResponse.
+func WithClassifier(classify func(*http.Response, error) breaker.Outcome) Option {
+	return func(t *Transport) { t.classify = classify }
+}
+
+// WithRejectResponse makes the rejected requests return a synthetic 503
+// Service Unavailable response, instead of a *breaker.RejectedError.
+func WithRejectResponse() Option {
+	return func(t *Transport) { t.rejectWithResponse = true }
+}
+
+// NewTransport returns a Transport that sends requests with base, nil
+// means http.DefaultTransport.
+func NewTransport(base http.RoundTripper, opts ...Option) *Transport {
+	t := &Transport{
+		base:     base,
+		key:      func(req *http.Request) string { return req.URL.Host },
+		classify: ClassifyResponse,
+	}
+
+	for _, opt := range opts {
+		opt(t)
+	}
+
+	if t.base == nil {
+		t.base = http.DefaultTransport
+	}
+	if t.registry == nil {
+		// A registry without options is always valid.
+		t.registry, _ = breaker.NewRegistry()
+	}
+
+	return t
+}
+
+// ClassifyResponse is the default classifier of Transport: transport
+// errors, 5xx and 429 Too Many Requests are failures, any other response
+// is a success.
+func ClassifyResponse(resp *http.Response, err error) breaker.Outcome {
+	if err != nil {
+		return breaker.OutcomeFailure
+	}
+	return ClassifyStatus(resp.StatusCode)
+}
+
+// ClassifyStatus is the default classifier of Handler: 5xx and 429 Too
+// Many Requests are failures, any other status code is a success.
+func ClassifyStatus(code int) breaker.Outcome {
+	if code >= http.StatusInternalServerError || code == http.StatusTooManyRequests {
+		return breaker.OutcomeFailure
+	}
+	return breaker.OutcomeSuccess
+}
+
+// RoundTrip implements http.RoundTripper.
+//
+// A request is throttled by the criticality carried by its context, see
+// breaker.ContextWithCriticality. A request whose context is canceled by
+// the caller is not recorded.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	b := t.registry.Get(t.key(req))
+
+	allower, ok := b.(breaker.Allower)
+	if !ok {
+		return t.do(b, req)
+	}
+
+	done, err := allower.AllowContext(req.Context())
+	if err != nil {
+		return t.reject(req, err)
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	outcome := t.outcome(req, resp, err)
+	if outcome == breaker.OutcomeFailure && err == nil {
+		done(outcome, statusError(resp.StatusCode))
+	} else {
+		done(outcome, err)
+	}
+
+	return resp, err
+}
+
+// CloseIdleConnections closes the idle connections of the base
+// RoundTripper, if it has a CloseIdleConnections method.
+func (t *Transport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// do sends req through a breaker that cannot report an outcome other than
+// by the error of Do, so an ignored round trip is recorded as a success.
+func (t *Transport) do(b breaker.Breaker, req *http.Request) (*http.Response, error) {
+	var resp *http.Response
+	var err error
+	rejected := b.Do(func() error {
+		resp, err = t.base.RoundTrip(req)
+		if t.outcome(req, resp, err) == breaker.OutcomeFailure {
+			return errFailure
+		}
+		return nil
+	})
+	if rejected != nil && !errors.Is(rejected, errFailure) {
+		return t.reject(req, rejected)
+	}
+
+	return resp, err
+}
+
+// errFailure reports a failed round trip to a breaker.
+var errFailure = errors.New("breakerhttp: round trip failed")
+
+// statusError is the error reported to a breaker for a response whose
+// status code is classified as a failure.
+type statusError int
+
+func (code statusError) Error() string {
+	return "breakerhttp: status " + strconv.Itoa(int(code)) + " " + http.StatusText(int(code))
+}
+
+func (t *Transport) outcome(req *http.Request, resp *http.Response, err error) breaker.Outcome {
+	if err != nil && errors.Is(req.Context().Err(), context.Canceled) {
+		// The caller gave up, the backend is not to blame.
+		return breaker.OutcomeIgnored
+	}
+	return t.classify(resp, err)
+}
+
+// reject returns the error or the synthetic response of a rejected
+// request, or the error of its done context. Like any RoundTripper, it
+// closes the body of req.
+func (t *Transport) reject(req *http.Request, err error) (*http.Response, error) {
+	if req.Body != nil {
+		_ = req.Body.Close()
+	}
+
+	if !t.rejectWithResponse || !errors.Is(err, breaker.ErrServiceUnavailable) {
+		return nil, err
+	}
+
+	body := err.Error()
+	header := make(http.Header)
+	header.Set("Content-Type", "text/plain; charset=utf-8")
+	setRetryAfter(header, err)
+
+	return &http.Response{
+		Status:        strconv.Itoa(http.StatusServiceUnavailable) + " " + http.StatusText(http.StatusServiceUnavailable),
+		StatusCode:    http.StatusServiceUnavailable,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// setRetryAfter sets the Retry-After header, in whole seconds, from the
+// hint of a *breaker.RejectedError.
+func setRetryAfter(header http.Header, err error) {
+	var rejected *breaker.RejectedError
+	if errors.As(err, &rejected) && rejected.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(math.Ceil(rejected.RetryAfter.Seconds()))))
+	}
+}
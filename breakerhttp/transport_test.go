@@ -0,0 +1,269 @@
+package breakerhttp
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/chenyanchen/breaker"
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+// newTestServer returns a server that responds with the status code of
+// its path, e.g. /503.
+func newTestServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		code, err := strconv.Atoi(r.URL.Path[1:])
+		if err != nil {
+			code = http.StatusOK
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newTestRegistry returns a registry whose breakers drop as soon as the
+// drop ratio is above 0.
+func newTestRegistry(tb testing.TB, opts ...breaker.RegistryOption) *breaker.Registry {
+	tb.Helper()
+	opts = append([]breaker.RegistryOption{breaker.WithDefaultOptions(breaker.WithRandSource(breakertest.NewSource(0)))}, opts...)
+	registry, err := breaker.NewRegistry(opts...)
+	if err != nil {
+		tb.Fatalf("NewRegistry() error = %v", err)
+	}
+	return registry
+}
+
+func get(t *testing.T, client *http.Client, url string) (*http.Response, error) {
+	t.Helper()
+	req, err := http.NewRequestWithContext(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := client.Do(req)
+	if err == nil {
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+	}
+	return resp, err
+}
+
+func TestTransport_RoundTrip(t *testing.T) {
+	tests := []struct {
+		name         string
+		path         string
+		wantRejected bool
+		wantCause    string
+	}{
+		{name: "success", path: "/200", wantRejected: false},
+		{name: "client error is a success", path: "/404", wantRejected: false},
+		{name: "server error is a failure", path: "/500", wantRejected: true, wantCause: "breakerhttp: status 500 Internal Server Error"},
+		{name: "too many requests is a failure", path: "/429", wantRejected: true, wantCause: "breakerhttp: status 429 Too Many Requests"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := newTestServer(t)
+			client := &http.Client{Transport: NewTransport(nil, WithRegistry(newTestRegistry(t)))}
+
+			if _, err := get(t, client, srv.URL+tt.path); err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+
+			_, err := get(t, client, srv.URL+"/200")
+			if rejected := errors.Is(err, breaker.ErrServiceUnavailable); rejected != tt.wantRejected {
+				t.Errorf("Get() error = %v, wantRejected %v", err, tt.wantRejected)
+			}
+			var rejected *breaker.RejectedError
+			if errors.As(err, &rejected) && (rejected.Cause == nil || rejected.Cause.Error() != tt.wantCause) {
+				t.Errorf("RejectedError.Cause = %v, want %s", rejected.Cause, tt.wantCause)
+			}
+		})
+	}
+}
+
+func TestTransport_RoundTrip_transportError(t *testing.T) {
+	srv := newTestServer(t)
+	client := &http.Client{Transport: NewTransport(nil, WithRegistry(newTestRegistry(t)))}
+	url := srv.URL
+	srv.Close()
+
+	if _, err := get(t, client, url); err == nil || errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Fatalf("Get() error = %v, want a transport error", err)
+	}
+
+	var rejected *breaker.RejectedError
+	if _, err := get(t, client, url); !errors.As(err, &rejected) {
+		t.Fatalf("Get() error = %v, want a *breaker.RejectedError", err)
+	}
+	if rejected.Name != srv.Listener.Addr().String() {
+		t.Errorf("RejectedError.Name = %q, want %q", rejected.Name, srv.Listener.Addr().String())
+	}
+	if rejected.Cause == nil {
+		t.Error("RejectedError.Cause = nil, want the transport error")
+	}
+}
+
+func TestTransport_RoundTrip_perHost(t *testing.T) {
+	failing, healthy := newTestServer(t), newTestServer(t)
+	client := &http.Client{Transport: NewTransport(nil, WithRegistry(newTestRegistry(t)))}
+
+	_, _ = get(t, client, failing.URL+"/503")
+
+	if _, err := get(t, client, failing.URL); !errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Errorf("Get() failing error = %v, want %v", err, breaker.ErrServiceUnavailable)
+	}
+	if _, err := get(t, client, healthy.URL); err != nil {
+		t.Errorf("Get() healthy error = %v, want nil", err)
+	}
+}
+
+func TestTransport_RoundTrip_WithKey(t *testing.T) {
+	srv := newTestServer(t)
+	client := &http.Client{Transport: NewTransport(nil,
+		WithRegistry(newTestRegistry(t)),
+		WithKey(func(req *http.Request) string { return req.URL.Host + req.URL.Path }),
+	)}
+
+	_, _ = get(t, client, srv.URL+"/500")
+
+	if _, err := get(t, client, srv.URL+"/500"); !errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Errorf("Get() /500 error = %v, want %v", err, breaker.ErrServiceUnavailable)
+	}
+	if _, err := get(t, client, srv.URL+"/200"); err != nil {
+		t.Errorf("Get() /200 error = %v, want nil", err)
+	}
+}
+
+func TestTransport_RoundTrip_WithRejectResponse(t *testing.T) {
+	srv := newTestServer(t)
+	client := &http.Client{Transport: NewTransport(nil, WithRegistry(newTestRegistry(t)), WithRejectResponse())}
+
+	_, _ = get(t, client, srv.URL+"/500")
+
+	resp, err := get(t, client, srv.URL+"/200")
+	if err != nil {
+		t.Fatalf("Get() error = %v, want nil", err)
+	}
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("StatusCode = %d, want %d", resp.StatusCode, http.StatusServiceUnavailable)
+	}
+	// The default bucket interval is 500ms.
+	if got := resp.Header.Get("Retry-After"); got != "1" {
+		t.Errorf("Retry-After = %q, want %q", got, "1")
+	}
+}
+
+func TestTransport_RoundTrip_callerCanceled(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			<-release
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	client := &http.Client{Transport: NewTransport(nil, WithRegistry(newTestRegistry(t)))}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"/slow", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go cancel()
+	if _, err = client.Do(req); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Do() error = %v, want %v", err, context.Canceled)
+	}
+
+	if _, err = get(t, client, srv.URL); errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Errorf("Get() error = %v, the canceled request was recorded as a failure", err)
+	}
+}
+
+func TestTransport_RoundTrip_criticality(t *testing.T) {
+	srv := newTestServer(t)
+	// (2 - 1.5*1) / (2 + 1) is 1/6, and 1/3 for Sheddable.
+	registry := newTestRegistry(t, breaker.WithDefaultOptions(breaker.WithRandSource(breakertest.NewSource(0.25))))
+	transport := NewTransport(nil, WithRegistry(registry), WithRejectResponse())
+	client := &http.Client{Transport: transport}
+	_, _ = get(t, client, srv.URL+"/200")
+	_, _ = get(t, client, srv.URL+"/500")
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	steps := []struct {
+		name       string
+		ctx        context.Context
+		wantStatus int
+		wantErr    error
+	}{
+		{name: "sheddable", ctx: breaker.ContextWithCriticality(context.Background(), breaker.Sheddable), wantStatus: http.StatusServiceUnavailable},
+		{name: "critical", ctx: breaker.ContextWithCriticality(context.Background(), breaker.Critical), wantStatus: http.StatusOK},
+		{name: "canceled is not a rejection", ctx: canceled, wantErr: context.Canceled},
+	}
+	for _, step := range steps {
+		req, err := http.NewRequestWithContext(step.ctx, http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := transport.RoundTrip(req)
+		if !errors.Is(err, step.wantErr) {
+			t.Fatalf("%s: RoundTrip() error = %v, wantErr %v", step.name, err, step.wantErr)
+		}
+		if err != nil {
+			continue
+		}
+		_ = resp.Body.Close()
+		if resp.StatusCode != step.wantStatus {
+			t.Errorf("%s: StatusCode = %d, want %d", step.name, resp.StatusCode, step.wantStatus)
+		}
+	}
+}
+
+// plainBreaker implements Breaker but not Allower.
+type plainBreaker struct {
+	breaker.Breaker
+}
+
+func TestTransport_RoundTrip_plainBreaker(t *testing.T) {
+	srv := newTestServer(t)
+	registry := newTestRegistry(t, breaker.WithFactory(func(string) breaker.Breaker {
+		return plainBreaker{breaker.NewGoogleBreaker(breaker.WithRandSource(breakertest.NewSource(0)))}
+	}))
+	client := &http.Client{Transport: NewTransport(nil, WithRegistry(registry))}
+
+	resp, err := get(t, client, srv.URL+"/500")
+	if err != nil || resp.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("Get() = %v, %v, want a 500 response", resp, err)
+	}
+	if _, err = get(t, client, srv.URL+"/200"); !errors.Is(err, breaker.ErrServiceUnavailable) {
+		t.Errorf("Get() error = %v, want %v", err, breaker.ErrServiceUnavailable)
+	}
+}
+
+// idleTransport counts the calls to CloseIdleConnections.
+type idleTransport struct {
+	http.RoundTripper
+
+	closed int
+}
+
+func (t *idleTransport) CloseIdleConnections() { t.closed++ }
+
+func TestTransport_CloseIdleConnections(t *testing.T) {
+	base := &idleTransport{}
+	NewTransport(base).CloseIdleConnections()
+	if base.closed != 1 {
+		t.Errorf("base CloseIdleConnections() called %d times, want 1", base.closed)
+	}
+
+	// A base without CloseIdleConnections is left alone.
+	NewTransport(http.NewFileTransport(http.Dir("."))).CloseIdleConnections()
+}
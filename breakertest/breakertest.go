@@ -0,0 +1,81 @@
+// Package breakertest provides a fake clock and a fake random source, to
+// test code built on the breakers deterministically and without sleeping.
+package breakertest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock that only moves when told to. It is safe for
+// concurrent use.
+//
+// Pass its Now method to breaker.WithClock.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to t.
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+}
+
+// Set moves the clock to t.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+}
+
+// Source is a rand.Source that always yields the same value, so that
+// rand.New(src).Float64() returns the configured float. It is safe for
+// concurrent use.
+//
+// Pass it to breaker.WithRandSource: a request is dropped exactly when
+// the drop ratio is greater than the configured float.
+type Source struct {
+	mu sync.Mutex
+	v  uint64
+}
+
+// NewSource returns a Source yielding f, which must be in [0, 1).
+func NewSource(f float64) *Source {
+	s := &Source{}
+	s.Set(f)
+	return s
+}
+
+// Set changes the float yielded by the source, f must be in [0, 1).
+func (s *Source) Set(f float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The inverse of rand.Float64, which uses the low 53 bits.
+	s.v = uint64(f * (1 << 53))
+}
+
+// Uint64 implements rand.Source.
+func (s *Source) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.v
+}
@@ -0,0 +1,30 @@
+package breakertest
+
+import (
+	"math/rand/v2"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	start := time.Unix(0, 0)
+	clock := NewClock(start)
+
+	clock.Advance(time.Second)
+	if got, want := clock.Now(), start.Add(time.Second); !got.Equal(want) {
+		t.Errorf("Now() = %v, want %v", got, want)
+	}
+
+	clock.Set(start)
+	if got := clock.Now(); !got.Equal(start) {
+		t.Errorf("Now() = %v, want %v", got, start)
+	}
+}
+
+func TestSource(t *testing.T) {
+	for _, f := range []float64{0, 0.25, 0.5, 0.99} {
+		if got := rand.New(NewSource(f)).Float64(); got != f {
+			t.Errorf("Float64() = %v, want %v", got, f)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/chenyanchen/breaker/rollingwindow"
+)
+
+const (
+	defaultMaxFailures    = 5
+	defaultOpenTimeout    = time.Second * 10
+	defaultHalfOpenProbes = 1
+)
+
+// State is the state of a classic circuit breaker.
+type State int
+
+const (
+	// StateClosed lets every call through.
+	StateClosed State = iota
+	// StateOpen rejects every call until the open timeout elapses.
+	StateOpen
+	// StateHalfOpen lets a limited number of probes through to decide
+	// whether to close or to open again.
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// classicBreaker is the Closed/Open/Half-Open circuit breaker.
+//
+// It trips to open after maxFailures consecutive failures, or when the
+// failure ratio over the rolling window reaches failureRatio. After
+// openTimeout it admits halfOpenProbes probes, closing again if all of
+// them succeed and opening again on the first failure.
+type classicBreaker struct {
+	name string
+
+	maxFailures int
+
+	failureRatio float64
+	minRequests  int
+
+	openTimeout    time.Duration
+	halfOpenProbes int
+
+	size     int
+	interval time.Duration
+
+	now func() time.Time
+
+	mu sync.Mutex
+
+	state State
+
+	// generation increases on every state change, so outcomes of calls
+	// admitted in an earlier state are discarded.
+	generation uint64
+
+	consecutiveFailures int
+	openedAt            time.Time
+
+	probes         int
+	probeSuccesses int
+
+	// lastFailure is the most recent error recorded as a failure.
+	lastFailure error
+
+	stat *rollingwindow.RollingWindow
+}
+
+type ClassicOption func(*classicBreaker)
+
+// WithClassicName sets the name of the breaker, reported in the errors it
+// returns.
+func WithClassicName(name string) ClassicOption {
+	return func(b *classicBreaker) { b.name = name }
+}
+
+// WithMaxFailures trips the breaker after n consecutive failures,
+// n <= 0 disables this condition.
+func WithMaxFailures(n int) ClassicOption {
+	return func(b *classicBreaker) { b.maxFailures = n }
+}
+
+// WithFailureRatio trips the breaker when the failure ratio over the
+// rolling window reaches ratio, once at least minRequests requests have
+// been recorded. A ratio <= 0 disables this condition.
+func WithFailureRatio(ratio float64, minRequests int) ClassicOption {
+	return func(b *classicBreaker) {
+		b.failureRatio = ratio
+		b.minRequests = minRequests
+	}
+}
+
+// WithOpenTimeout sets how long the breaker stays open before it lets
+// probes through.
+func WithOpenTimeout(d time.Duration) ClassicOption {
+	return func(b *classicBreaker) { b.openTimeout = d }
+}
+
+// WithHalfOpenProbes sets how many probes are admitted in half-open state,
+// all of them must succeed to close the breaker.
+func WithHalfOpenProbes(n int) ClassicOption {
+	return func(b *classicBreaker) { b.halfOpenProbes = n }
+}
+
+// WithClassicWindow sets the rolling window used for the failure ratio.
+func WithClassicWindow(size int, interval time.Duration) ClassicOption {
+	return func(b *classicBreaker) {
+		b.size = size
+		b.interval = interval
+	}
+}
+
+// WithClassicClock sets the clock of the breaker, it defaults to time.Now.
+func WithClassicClock(now func() time.Time) ClassicOption {
+	return func(b *classicBreaker) { b.now = now }
+}
+
+// NewClassicBreaker returns a classic breaker configured by opts. It
+// panics if opts are not valid, use NewClassic to get an error instead.
+func NewClassicBreaker(opts ...ClassicOption) *classicBreaker {
+	b, err := NewClassic(opts...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// NewClassic is like NewClassicBreaker, but it returns an error wrapping
+// ErrInvalidConfig if opts are not valid.
+func NewClassic(opts ...ClassicOption) (*classicBreaker, error) {
+	b := &classicBreaker{
+		maxFailures:    defaultMaxFailures,
+		openTimeout:    defaultOpenTimeout,
+		halfOpenProbes: defaultHalfOpenProbes,
+		size:           defaultSize,
+		interval:       defaultInterval,
+		now:            time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	if err := b.validate(); err != nil {
+		return nil, err
+	}
+
+	if b.halfOpenProbes < 1 {
+		b.halfOpenProbes = 1
+	}
+
+	b.stat = b.newWindow()
+
+	return b, nil
+}
+
+// validate reports every invalid option of b, in an error wrapping
+// ErrInvalidConfig.
+func (b *classicBreaker) validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+
+	if math.IsNaN(b.failureRatio) || b.failureRatio > 1 {
+		invalid("failure ratio must be at most 1, got %v", b.failureRatio)
+	}
+	if b.minRequests < 0 {
+		invalid("min requests must not be negative, got %d", b.minRequests)
+	}
+	if b.openTimeout < 0 {
+		invalid("open timeout must not be negative, got %v", b.openTimeout)
+	}
+	if b.size < 1 {
+		invalid("window size must be positive, got %d", b.size)
+	}
+	if b.interval <= 0 {
+		invalid("window interval must be positive, got %v", b.interval)
+	}
+	if b.now == nil {
+		invalid("clock must not be nil")
+	}
+
+	return errors.Join(errs...)
+}
+
+func (b *classicBreaker) Do(f func() error) error {
+	return b.do(context.Background(), f)
+}
+
+// DoContext is like Do, but it rejects the call with ctx.Err() if ctx is
+// already done, and passes ctx through to f.
+//
+// An error returned after ctx has been canceled by the caller is not
+// counted as a backend failure.
+func (b *classicBreaker) DoContext(ctx context.Context, f func(context.Context) error) error {
+	return b.do(ctx, func() error { return f(ctx) })
+}
+
+// State returns the current state of the breaker.
+func (b *classicBreaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+	return b.state
+}
+
+func (b *classicBreaker) do(ctx context.Context, f func() error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	generation, err := b.before()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if v := recover(); v != nil {
+			b.after(generation, OutcomeFailure, nil)
+			panic(v)
+		}
+	}()
+
+	err = f()
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// The caller gave up, the backend is not to blame.
+		b.after(generation, OutcomeIgnored, nil)
+		return err
+	}
+
+	b.after(generation, ClassifyError(err), err)
+
+	return err
+}
+
+// Allow reports whether a call may proceed, for calls that cannot be
+// wrapped in Do. If it may, the outcome of the call must be reported
+// through done exactly once.
+func (b *classicBreaker) Allow() (done func(Outcome, error), err error) {
+	generation, err := b.before()
+	if err != nil {
+		return nil, err
+	}
+
+	return newPendingCall(func(outcome Outcome, err error) { b.after(generation, outcome, err) }), nil
+}
+
+// AllowContext is like Allow, but it rejects the call with ctx.Err() if
+// ctx is already done.
+func (b *classicBreaker) AllowContext(ctx context.Context) (done func(Outcome, error), err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.Allow()
+}
+
+func (b *classicBreaker) before() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.refresh()
+
+	switch b.state {
+	case StateOpen:
+		return 0, b.rejected(b.openTimeout - b.now().Sub(b.openedAt))
+	case StateHalfOpen:
+		if b.probes >= b.halfOpenProbes {
+			return 0, b.rejected(0)
+		}
+		b.probes++
+	}
+
+	return b.generation, nil
+}
+
+// rejected returns the error of a rejected call, b.mu must be held.
+func (b *classicBreaker) rejected(retryAfter time.Duration) *RejectedError {
+	totals := b.stat.Totals()
+	return &RejectedError{
+		Name:       b.name,
+		DropRatio:  1,
+		Accepts:    totals.Value,
+		Requests:   totals.Count,
+		Cause:      b.lastFailure,
+		RetryAfter: retryAfter,
+	}
+}
+
+// after records the outcome of a call admitted in generation, err is the
+// error of the call, if known.
+func (b *classicBreaker) after(generation uint64, outcome Outcome, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	if outcome == OutcomeFailure && err != nil {
+		b.lastFailure = err
+	}
+
+	switch b.state {
+	case StateClosed:
+		switch outcome {
+		case OutcomeSuccess:
+			b.stat.Add(1)
+			b.consecutiveFailures = 0
+		case OutcomeFailure:
+			b.stat.Add(0)
+			b.consecutiveFailures++
+			if b.tripped() {
+				b.setState(StateOpen)
+			}
+		case OutcomeIgnored:
+		}
+	case StateHalfOpen:
+		switch outcome {
+		case OutcomeSuccess:
+			b.probeSuccesses++
+			if b.probeSuccesses >= b.halfOpenProbes {
+				b.setState(StateClosed)
+			}
+		case OutcomeFailure:
+			b.setState(StateOpen)
+		case OutcomeIgnored:
+			// Give the probe slot back.
+			b.probes--
+		}
+	}
+}
+
+func (b *classicBreaker) tripped() bool {
+	if b.maxFailures > 0 && b.consecutiveFailures >= b.maxFailures {
+		return true
+	}
+
+	if b.failureRatio <= 0 {
+		return false
+	}
+
+	totals := b.stat.Totals()
+	successes, requests := totals.Value, totals.Count
+	if requests == 0 || requests < float64(b.minRequests) {
+		return false
+	}
+
+	return (requests-successes)/requests >= b.failureRatio
+}
+
+// refresh moves an open breaker to half-open once the open timeout elapsed.
+func (b *classicBreaker) refresh() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.openTimeout {
+		b.setState(StateHalfOpen)
+	}
+}
+
+func (b *classicBreaker) setState(state State) {
+	b.state = state
+	b.generation++
+
+	switch state {
+	case StateClosed:
+		b.consecutiveFailures = 0
+		b.stat = b.newWindow()
+	case StateOpen:
+		b.openedAt = b.now()
+	case StateHalfOpen:
+		b.probes = 0
+		b.probeSuccesses = 0
+	}
+}
+
+func (b *classicBreaker) newWindow() *rollingwindow.RollingWindow {
+	w, err := rollingwindow.New(b.size, b.interval, rollingwindow.WithClock(b.now))
+	if err != nil {
+		panic(err)
+	}
+	return w
+}
@@ -0,0 +1,278 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func newTestClassicBreaker(clock *breakertest.Clock, opts ...ClassicOption) *classicBreaker {
+	return NewClassicBreaker(append(opts, WithClassicClock(clock.Now))...)
+}
+
+func succeed() error { return nil }
+func fail() error    { return errTest }
+
+func TestNewClassic(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []ClassicOption
+		wantErrs []string
+	}{
+		{
+			name: "default",
+		}, {
+			name: "disabled conditions",
+			opts: []ClassicOption{WithMaxFailures(0), WithFailureRatio(0, 0), WithOpenTimeout(0)},
+		}, {
+			name:     "zero interval",
+			opts:     []ClassicOption{WithClassicWindow(20, 0)},
+			wantErrs: []string{"window interval must be positive, got 0s"},
+		}, {
+			name:     "NaN failure ratio",
+			opts:     []ClassicOption{WithFailureRatio(math.NaN(), 10)},
+			wantErrs: []string{"failure ratio must be at most 1, got NaN"},
+		}, {
+			name: "every invalid option",
+			opts: []ClassicOption{
+				WithFailureRatio(1.5, -1),
+				WithOpenTimeout(-time.Second),
+				WithClassicWindow(0, time.Second),
+				WithClassicClock(nil),
+			},
+			wantErrs: []string{
+				"failure ratio must be at most 1, got 1.5",
+				"min requests must not be negative, got -1",
+				"open timeout must not be negative, got -1s",
+				"window size must be positive, got 0",
+				"clock must not be nil",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := NewClassic(tt.opts...)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("NewClassic() error = %v, want nil", err)
+				}
+				if err = b.Do(succeed); err != nil {
+					t.Errorf("Do() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("NewClassic() error = %v, want %v", err, ErrInvalidConfig)
+			}
+			if b != nil {
+				t.Errorf("NewClassic() = %v, want nil", b)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("NewClassic() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), ErrInvalidConfig.Error()); got != len(tt.wantErrs) {
+				t.Errorf("NewClassic() reported %d errors, want %d", got, len(tt.wantErrs))
+			}
+		})
+	}
+}
+
+func TestNewClassicBreaker_invalid(t *testing.T) {
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("NewClassicBreaker() panic = %v, want %v", err, ErrInvalidConfig)
+		}
+	}()
+
+	NewClassicBreaker(WithClassicWindow(20, 0))
+}
+
+func Test_classicBreaker_Do(t *testing.T) {
+	tests := []struct {
+		name            string
+		breakerCreateFn func(clock *breakertest.Clock) *classicBreaker
+		f               func() error
+		wantErr         error
+		wantState       State
+	}{
+		{
+			name:            "closed success",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker { return newTestClassicBreaker(clock) },
+			f:               succeed,
+			wantErr:         nil,
+			wantState:       StateClosed,
+		}, {
+			name:            "closed inner error",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker { return newTestClassicBreaker(clock) },
+			f:               fail,
+			wantErr:         errTest,
+			wantState:       StateClosed,
+		}, {
+			name: "trip on consecutive failures",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock, WithMaxFailures(3))
+				for i := 0; i < 2; i++ {
+					_ = b.Do(fail)
+				}
+				return b
+			},
+			f:         fail,
+			wantErr:   errTest,
+			wantState: StateOpen,
+		}, {
+			name: "success resets consecutive failures",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock, WithMaxFailures(3))
+				_ = b.Do(fail)
+				_ = b.Do(fail)
+				_ = b.Do(succeed)
+				_ = b.Do(fail)
+				return b
+			},
+			f:         fail,
+			wantErr:   errTest,
+			wantState: StateClosed,
+		}, {
+			name: "trip on failure ratio",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock,
+					WithMaxFailures(0),
+					WithFailureRatio(0.5, 4),
+					WithClassicWindow(10, time.Minute),
+				)
+				_ = b.Do(succeed)
+				_ = b.Do(fail)
+				_ = b.Do(succeed)
+				return b
+			},
+			f:         fail,
+			wantErr:   errTest,
+			wantState: StateOpen,
+		}, {
+			name: "failure ratio below minimum requests",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				return newTestClassicBreaker(clock,
+					WithMaxFailures(0),
+					WithFailureRatio(0.5, 4),
+					WithClassicWindow(10, time.Minute),
+				)
+			},
+			f:         fail,
+			wantErr:   errTest,
+			wantState: StateClosed,
+		}, {
+			name: "open rejects",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock, WithMaxFailures(1))
+				_ = b.Do(fail)
+				return b
+			},
+			f:         succeed,
+			wantErr:   ErrServiceUnavailable,
+			wantState: StateOpen,
+		}, {
+			name: "half-open probe success closes",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock, WithMaxFailures(1), WithOpenTimeout(time.Second))
+				_ = b.Do(fail)
+				clock.Advance(time.Second)
+				return b
+			},
+			f:         succeed,
+			wantErr:   nil,
+			wantState: StateClosed,
+		}, {
+			name: "half-open probe failure opens",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock, WithMaxFailures(1), WithOpenTimeout(time.Second))
+				_ = b.Do(fail)
+				clock.Advance(time.Second)
+				return b
+			},
+			f:         fail,
+			wantErr:   errTest,
+			wantState: StateOpen,
+		}, {
+			name: "half-open waits for all probes",
+			breakerCreateFn: func(clock *breakertest.Clock) *classicBreaker {
+				b := newTestClassicBreaker(clock,
+					WithMaxFailures(1),
+					WithOpenTimeout(time.Second),
+					WithHalfOpenProbes(2),
+				)
+				_ = b.Do(fail)
+				clock.Advance(time.Second)
+				return b
+			},
+			f:         succeed,
+			wantErr:   nil,
+			wantState: StateHalfOpen,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := breakertest.NewClock(time.Unix(0, 0))
+			b := tt.breakerCreateFn(clock)
+			if err := b.Do(tt.f); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if state := b.State(); state != tt.wantState {
+				t.Errorf("State() = %v, want %v", state, tt.wantState)
+			}
+		})
+	}
+}
+
+func Test_classicBreaker_halfOpenProbeLimit(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := newTestClassicBreaker(clock, WithMaxFailures(1), WithOpenTimeout(time.Second))
+	_ = b.Do(fail)
+	clock.Advance(time.Second)
+
+	err := b.Do(func() error {
+		// The only probe is in flight, further calls are rejected.
+		if err := b.Do(succeed); !errors.Is(err, ErrServiceUnavailable) {
+			t.Errorf("Do() error = %v, wantErr %v", err, ErrServiceUnavailable)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Errorf("Do() error = %v, wantErr nil", err)
+	}
+	if state := b.State(); state != StateClosed {
+		t.Errorf("State() = %v, want %v", state, StateClosed)
+	}
+}
+
+func Test_classicBreaker_DoContext_callerCanceled(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := newTestClassicBreaker(clock, WithMaxFailures(1), WithOpenTimeout(time.Second))
+	_ = b.Do(fail)
+	clock.Advance(time.Second)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.DoContext(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DoContext() error = %v, wantErr %v", err, context.Canceled)
+	}
+
+	// The canceled probe gave its slot back.
+	if err = b.Do(succeed); err != nil {
+		t.Errorf("Do() error = %v, wantErr nil", err)
+	}
+	if state := b.State(); state != StateClosed {
+		t.Errorf("State() = %v, want %v", state, StateClosed)
+	}
+}
@@ -33,6 +33,17 @@ func TestTemplateValidationPipeline(t *testing.T) {
 								{Name: "err", Type: "error"},
 							},
 						},
+						{
+							Name: "FilterContext",
+							Params: []Param{
+								{Name: "ctx", Type: "context.Context"},
+								{Name: "elements", Type: "[]string"},
+							},
+							Results: []Param{
+								{Name: "filtered", Type: "[]string"},
+								{Name: "err", Type: "error"},
+							},
+						},
 					},
 				},
 			},
@@ -56,6 +67,10 @@ func TestTemplateValidationPipeline(t *testing.T) {
 			t.Fatalf("read generated code: %v", err)
 		}
 
+		if !strings.Contains(string(data), "breaker.ExecuteContext(ctx, b.breaker,") {
+			t.Fatalf("generated code does not use breaker.ExecuteContext for FilterContext:\n%s", data)
+		}
+
 		if err = os.WriteFile(output, data, 0o644); err != nil {
 			t.Fatalf("write generated code: %v", err)
 		}
@@ -102,8 +117,11 @@ replace github.com/chenyanchen/breaker => %s
 
 	source := `package sourcepkg
 
+import "context"
+
 type Filter interface {
 	Filter(elements []string) ([]string, error)
+	FilterContext(ctx context.Context, elements []string) ([]string, error)
 }
 `
 	if err = os.WriteFile(filepath.Join(workdir, "sourcepkg", "source.go"), []byte(source), 0o644); err != nil {
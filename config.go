@@ -0,0 +1,247 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/chenyanchen/breaker/rollingwindow"
+)
+
+var ErrInvalidConfig = errors.New("invalid breaker config")
+
+// Config is the configuration of the adaptive throttling breaker, see New.
+// Start from DefaultConfig, the zero Config is not valid.
+type Config struct {
+	// Name identifies the breaker in the errors it returns.
+	Name string
+
+	// K is how many requests per accepted one are let through before
+	// dropping starts, see https://sre.google/sre-book/handling-overload/#eq2101.
+	// It must be positive.
+	K float64
+
+	// MinRequests lets every request through until the rolling window has
+	// recorded at least that many requests.
+	MinRequests int
+
+	// MaxDropRatio caps the drop ratio, it must be in [0, 1].
+	MaxDropRatio float64
+
+	// MinProbes requests are let through per bucket interval, whatever
+	// the drop ratio.
+	MinProbes int
+
+	// SlowCallThreshold records the successful calls that take longer as
+	// failures. Zero disables it.
+	SlowCallThreshold time.Duration
+
+	// LatencyHistogram keeps a latency histogram of the calls over the
+	// rolling window.
+	LatencyHistogram bool
+
+	// ErrorClassifier sets how the errors returned by the protected call
+	// are recorded, nil means ClassifyError.
+	ErrorClassifier func(error) Outcome
+
+	// WindowSize buckets of WindowInterval make up the rolling window.
+	WindowSize     int
+	WindowInterval time.Duration
+
+	// Clock is the clock of the breaker, nil means time.Now.
+	Clock func() time.Time
+
+	// RandSource decides which requests to drop, nil means the global
+	// source of math/rand/v2. A source shared by several breakers must be
+	// safe for concurrent use, WithRandSource makes it so.
+	RandSource rand.Source
+
+	// Observer is notified of the events of the breaker, it may be nil.
+	Observer Observer
+
+	// DropRatioThresholds are the drop ratios whose crossing emits an
+	// EventThreshold, each must be in [0, 1].
+	DropRatioThresholds []float64
+
+	// CriticalityMultipliers scale the drop ratio per criticality, they
+	// must not be negative. A missing criticality uses its default.
+	CriticalityMultipliers map[Criticality]float64
+
+	// Snapshot seeds the rolling window, e.g. with the buckets of Stats
+	// saved by a previous process.
+	Snapshot []Bucket
+}
+
+// DefaultConfig returns the configuration used by NewGoogleBreaker when no
+// option is given.
+func DefaultConfig() Config {
+	cfg := Config{
+		K:                   defaultK,
+		MaxDropRatio:        1,
+		ErrorClassifier:     ClassifyError,
+		WindowSize:          defaultSize,
+		WindowInterval:      defaultInterval,
+		Clock:               time.Now,
+		DropRatioThresholds: []float64{0},
+	}
+
+	multipliers := defaultMultipliers()
+	cfg.CriticalityMultipliers = make(map[Criticality]float64, len(multipliers))
+	for c, m := range multipliers {
+		cfg.CriticalityMultipliers[Criticality(c)] = m
+	}
+
+	return cfg
+}
+
+// New returns an adaptive throttling breaker configured by cfg. It returns
+// an error wrapping ErrInvalidConfig, which lists every invalid field, if
+// cfg is not valid.
+func New(cfg Config) (Breaker, error) {
+	b, err := newGoogleBreaker(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// Validate reports every invalid field of cfg, in an error wrapping
+// ErrInvalidConfig.
+func (cfg *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%w: "+format, append([]any{ErrInvalidConfig}, args...)...))
+	}
+
+	if !(cfg.K > 0) || math.IsInf(cfg.K, 1) {
+		invalid("K must be positive and finite, got %v", cfg.K)
+	}
+	if cfg.MinRequests < 0 {
+		invalid("MinRequests must not be negative, got %d", cfg.MinRequests)
+	}
+	if !isRatio(cfg.MaxDropRatio) {
+		invalid("MaxDropRatio must be in [0, 1], got %v", cfg.MaxDropRatio)
+	}
+	if cfg.MinProbes < 0 {
+		invalid("MinProbes must not be negative, got %d", cfg.MinProbes)
+	}
+	if cfg.SlowCallThreshold < 0 {
+		invalid("SlowCallThreshold must not be negative, got %v", cfg.SlowCallThreshold)
+	}
+	if cfg.WindowSize < 1 {
+		invalid("WindowSize must be positive, got %d", cfg.WindowSize)
+	}
+	if cfg.WindowInterval <= 0 {
+		invalid("WindowInterval must be positive, got %v", cfg.WindowInterval)
+	}
+	for _, threshold := range cfg.DropRatioThresholds {
+		if !isRatio(threshold) {
+			invalid("DropRatioThresholds must be in [0, 1], got %v", threshold)
+		}
+	}
+	for _, c := range slices.Sorted(maps.Keys(cfg.CriticalityMultipliers)) {
+		m := cfg.CriticalityMultipliers[c]
+		if !c.valid() {
+			invalid("CriticalityMultipliers has an unknown criticality %d", int(c))
+		}
+		if !(m >= 0) || math.IsInf(m, 1) {
+			invalid("CriticalityMultipliers[%v] must not be negative and finite, got %v", c, m)
+		}
+	}
+	for i, bucket := range cfg.Snapshot {
+		if !(bucket.Accepts >= 0) || !(bucket.Requests >= bucket.Accepts) || math.IsInf(bucket.Requests, 1) {
+			invalid("Snapshot[%d] must have 0 <= Accepts <= Requests, got %+v", i, bucket)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func isRatio(v float64) bool {
+	return v >= 0 && v <= 1
+}
+
+func newGoogleBreaker(cfg Config) (*googleBreaker, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	b := &googleBreaker{
+		name:              cfg.Name,
+		k:                 cfg.K,
+		minRequests:       float64(cfg.MinRequests),
+		maxDropRatio:      cfg.MaxDropRatio,
+		multipliers:       defaultMultipliers(),
+		minProbes:         cfg.MinProbes,
+		classify:          cfg.ErrorClassifier,
+		slowCallThreshold: cfg.SlowCallThreshold,
+		latencyHistogram:  cfg.LatencyHistogram,
+		size:              cfg.WindowSize,
+		interval:          cfg.WindowInterval,
+		now:               cfg.Clock,
+		random:            rand.Float64,
+		observer:          cfg.Observer,
+		thresholds:        slices.Sorted(slices.Values(cfg.DropRatioThresholds)),
+	}
+
+	if b.classify == nil {
+		b.classify = ClassifyError
+	}
+	if b.now == nil {
+		b.now = time.Now
+	}
+	if cfg.RandSource != nil {
+		b.random = rand.New(lockSource(cfg.RandSource)).Float64
+	}
+	for c, m := range cfg.CriticalityMultipliers {
+		b.multipliers[c] = m
+	}
+
+	windowOpts := []rollingwindow.Option{rollingwindow.WithClock(b.now)}
+	if b.latencyHistogram {
+		windowOpts = append(windowOpts, rollingwindow.WithHistogram())
+	}
+	stat, err := rollingwindow.New(b.size, b.interval, windowOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	b.stat = stat
+
+	if cfg.Snapshot != nil {
+		buckets := make([]rollingwindow.Bucket, len(cfg.Snapshot))
+		for i, bucket := range cfg.Snapshot {
+			buckets[i] = rollingwindow.Bucket{Value: bucket.Accepts, Count: bucket.Requests}
+		}
+		b.stat.Restore(buckets)
+	}
+
+	return b, nil
+}
+
+// lockedSource is a rand.Source that is safe for concurrent use.
+type lockedSource struct {
+	mu  sync.Mutex
+	src rand.Source
+}
+
+func (s *lockedSource) Uint64() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.src.Uint64()
+}
+
+// lockSource returns src guarded by a mutex, unless it already is.
+func lockSource(src rand.Source) rand.Source {
+	if src == nil {
+		return nil
+	}
+	if _, ok := src.(*lockedSource); ok {
+		return src
+	}
+	return &lockedSource{src: src}
+}
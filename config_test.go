@@ -0,0 +1,113 @@
+package breaker
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		modify   func(cfg *Config)
+		wantErrs []string
+	}{
+		{
+			name:   "default",
+			modify: func(*Config) {},
+		}, {
+			name: "nil defaults",
+			modify: func(cfg *Config) {
+				cfg.ErrorClassifier = nil
+				cfg.Clock = nil
+				cfg.DropRatioThresholds = nil
+				cfg.CriticalityMultipliers = nil
+			},
+		}, {
+			name:     "negative K",
+			modify:   func(cfg *Config) { cfg.K = -1 },
+			wantErrs: []string{"K must be positive and finite, got -1"},
+		}, {
+			name:     "NaN K",
+			modify:   func(cfg *Config) { cfg.K = math.NaN() },
+			wantErrs: []string{"K must be positive and finite, got NaN"},
+		}, {
+			name:     "zero interval",
+			modify:   func(cfg *Config) { cfg.WindowInterval = 0 },
+			wantErrs: []string{"WindowInterval must be positive, got 0s"},
+		}, {
+			name: "every invalid field",
+			modify: func(cfg *Config) {
+				cfg.K = math.Inf(1)
+				cfg.MinRequests = -1
+				cfg.MaxDropRatio = 1.5
+				cfg.MinProbes = -1
+				cfg.SlowCallThreshold = -time.Second
+				cfg.WindowSize = 0
+				cfg.DropRatioThresholds = []float64{-0.5}
+				cfg.CriticalityMultipliers = map[Criticality]float64{Sheddable: -1}
+				cfg.Snapshot = []Bucket{{Accepts: 2, Requests: 1}}
+			},
+			wantErrs: []string{
+				"K must be positive and finite, got +Inf",
+				"MinRequests must not be negative, got -1",
+				"MaxDropRatio must be in [0, 1], got 1.5",
+				"MinProbes must not be negative, got -1",
+				"SlowCallThreshold must not be negative, got -1s",
+				"WindowSize must be positive, got 0",
+				"DropRatioThresholds must be in [0, 1], got -0.5",
+				"CriticalityMultipliers[sheddable] must not be negative and finite, got -1",
+				"Snapshot[0] must have 0 <= Accepts <= Requests",
+			},
+		}, {
+			name:     "unknown criticality",
+			modify:   func(cfg *Config) { cfg.CriticalityMultipliers = map[Criticality]float64{42: 1} },
+			wantErrs: []string{"CriticalityMultipliers has an unknown criticality 42"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+
+			b, err := New(cfg)
+			if len(tt.wantErrs) == 0 {
+				if err != nil {
+					t.Fatalf("New() error = %v, want nil", err)
+				}
+				if err = b.Do(succeed); err != nil {
+					t.Errorf("Do() error = %v, want nil", err)
+				}
+				return
+			}
+
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Fatalf("New() error = %v, want %v", err, ErrInvalidConfig)
+			}
+			if b != nil {
+				t.Errorf("New() = %v, want nil", b)
+			}
+			for _, want := range tt.wantErrs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("New() error = %v, want it to contain %q", err, want)
+				}
+			}
+			if got := strings.Count(err.Error(), ErrInvalidConfig.Error()); got != len(tt.wantErrs) {
+				t.Errorf("New() reported %d errors, want %d", got, len(tt.wantErrs))
+			}
+		})
+	}
+}
+
+func TestNewGoogleBreaker_invalid(t *testing.T) {
+	defer func() {
+		err, _ := recover().(error)
+		if !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("NewGoogleBreaker() panic = %v, want %v", err, ErrInvalidConfig)
+		}
+	}()
+
+	NewGoogleBreaker(WithWindow(20, 0))
+}
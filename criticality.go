@@ -0,0 +1,105 @@
+package breaker
+
+import "context"
+
+// Criticality is how important a request is, from the most to the least
+// critical, as described in
+// https://sre.google/sre-book/handling-overload/#criticality-3ntGtL.
+//
+// The drop ratio of the breaker is scaled by a multiplier per criticality,
+// so sheddable background traffic is dropped first and critical user
+// traffic last.
+type Criticality int
+
+const (
+	// CriticalPlus is for the requests whose failure has a serious user
+	// visible impact. Its drop ratio is halved by default.
+	CriticalPlus Criticality = iota
+	// Critical is the default criticality of requests.
+	Critical
+	// SheddablePlus is for the requests for which partial unavailability
+	// is expected, e.g. batch jobs that retry. Its drop ratio is 1.5 times
+	// larger by default.
+	SheddablePlus
+	// Sheddable is for the requests for which frequent partial and
+	// occasional full unavailability is expected. Its drop ratio is
+	// doubled by default.
+	Sheddable
+
+	numCriticalities = iota
+)
+
+const (
+	criticalPlusMultiplier  = 0.5
+	criticalMultiplier      = 1
+	sheddablePlusMultiplier = 1.5
+	sheddableMultiplier     = 2
+)
+
+// defaultMultipliers returns the default drop ratio multiplier of every
+// criticality.
+func defaultMultipliers() [numCriticalities]float64 {
+	return [numCriticalities]float64{
+		CriticalPlus:  criticalPlusMultiplier,
+		Critical:      criticalMultiplier,
+		SheddablePlus: sheddablePlusMultiplier,
+		Sheddable:     sheddableMultiplier,
+	}
+}
+
+func (c Criticality) String() string {
+	switch c {
+	case CriticalPlus:
+		return "critical-plus"
+	case Critical:
+		return "critical"
+	case SheddablePlus:
+		return "sheddable-plus"
+	case Sheddable:
+		return "sheddable"
+	default:
+		return "unknown"
+	}
+}
+
+func (c Criticality) valid() bool {
+	return c >= CriticalPlus && c < numCriticalities
+}
+
+type criticalityKey struct{}
+
+// ContextWithCriticality returns a copy of ctx that carries c, DoContext,
+// AllowContext and ExecuteContext throttle the call by it.
+func ContextWithCriticality(ctx context.Context, c Criticality) context.Context {
+	return context.WithValue(ctx, criticalityKey{}, c)
+}
+
+// CriticalityFromContext returns the criticality carried by ctx, it
+// defaults to Critical.
+func CriticalityFromContext(ctx context.Context) Criticality {
+	if c, ok := ctx.Value(criticalityKey{}).(Criticality); ok && c.valid() {
+		return c
+	}
+	return Critical
+}
+
+// WithCriticalityMultiplier scales the drop ratio of the requests of
+// criticality c by m, before it is capped by WithMaxDropRatio. The
+// defaults are 0.5, 1, 1.5 and 2, from CriticalPlus to Sheddable.
+func WithCriticalityMultiplier(c Criticality, m float64) Option {
+	return func(cfg *Config) {
+		if cfg.CriticalityMultipliers == nil {
+			cfg.CriticalityMultipliers = make(map[Criticality]float64)
+		}
+		cfg.CriticalityMultipliers[c] = m
+	}
+}
+
+// DoWithCriticality is like Do, but it throttles the call by c. An
+// unknown criticality is throttled as Critical.
+func (b *googleBreaker) DoWithCriticality(c Criticality, f func() error) error {
+	if !c.valid() {
+		c = Critical
+	}
+	return b.do(context.Background(), c, f)
+}
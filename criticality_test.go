@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func Test_googleBreaker_DoWithCriticality(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []Option
+		random      float64
+		criticality Criticality
+		wantErr     error
+	}{
+		{
+			name:        "critical plus halves the drop ratio",
+			random:      0.3,
+			criticality: CriticalPlus,
+			wantErr:     nil,
+		}, {
+			name:        "critical",
+			random:      0.3,
+			criticality: Critical,
+			wantErr:     ErrServiceUnavailable,
+		}, {
+			name:        "critical accepted",
+			random:      0.6,
+			criticality: Critical,
+			wantErr:     nil,
+		}, {
+			name:        "sheddable plus",
+			random:      0.6,
+			criticality: SheddablePlus,
+			wantErr:     ErrServiceUnavailable,
+		}, {
+			name:        "sheddable",
+			random:      0.9,
+			criticality: Sheddable,
+			wantErr:     ErrServiceUnavailable,
+		}, {
+			name:        "sheddable capped by max drop ratio",
+			opts:        []Option{WithMaxDropRatio(0.8)},
+			random:      0.9,
+			criticality: Sheddable,
+			wantErr:     nil,
+		}, {
+			name:        "custom multiplier",
+			opts:        []Option{WithCriticalityMultiplier(Sheddable, 1)},
+			random:      0.6,
+			criticality: Sheddable,
+			wantErr:     nil,
+		}, {
+			name:        "unknown criticality is critical",
+			random:      0.6,
+			criticality: Criticality(42),
+			wantErr:     nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := breakertest.NewSource(0.999)
+			b := NewGoogleBreaker(append(tt.opts, WithRandSource(src))...)
+
+			// (1 - 1.5*0) / (1 + 1)
+			_ = b.Do(fail)
+
+			src.Set(tt.random)
+			if err := b.DoWithCriticality(tt.criticality, succeed); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DoWithCriticality() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_DoContext_criticality(t *testing.T) {
+	src := breakertest.NewSource(0.999)
+	b := NewGoogleBreaker(WithRandSource(src))
+	_ = b.Do(fail)
+
+	src.Set(0.6)
+	ctx := ContextWithCriticality(context.Background(), Sheddable)
+	err := b.DoContext(ctx, func(context.Context) error { return nil })
+	if !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("DoContext() error = %v, wantErr %v", err, ErrServiceUnavailable)
+	}
+
+	if err = b.DoContext(context.Background(), func(context.Context) error { return nil }); err != nil {
+		t.Errorf("DoContext() error = %v, wantErr nil", err)
+	}
+}
+
+func TestCriticalityFromContext(t *testing.T) {
+	if c := CriticalityFromContext(context.Background()); c != Critical {
+		t.Errorf("CriticalityFromContext() = %v, want %v", c, Critical)
+	}
+
+	ctx := ContextWithCriticality(context.Background(), SheddablePlus)
+	if c := CriticalityFromContext(ctx); c != SheddablePlus {
+		t.Errorf("CriticalityFromContext() = %v, want %v", c, SheddablePlus)
+	}
+}
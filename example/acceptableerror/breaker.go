@@ -14,41 +14,37 @@ type breakerContentService struct {
 	contentService example.ContentService
 }
 
-func NewBreakerContentService(breaker breaker.Breaker, contentService example.ContentService) example.ContentService {
+// NewBreakerContentService protects contentService with a breaker built
+// by NewBreaker from opts, so ErrContentNotFound is not counted against it.
+func NewBreakerContentService(contentService example.ContentService, opts ...breaker.Option) example.ContentService {
 	return &breakerContentService{
-		breaker:        breaker,
+		breaker:        NewBreaker(opts...),
 		contentService: contentService,
 	}
 }
 
-func (s *breakerContentService) GetContent(ctx context.Context, req *example.GetContentRequest) (*example.GetContentResponse, error) {
-	var resp *example.GetContentResponse
-	getContentFn := func() (err error) {
-		resp, err = s.contentService.GetContent(ctx, req)
-		return err
-	}
-
-	// handle acceptable errors
-	getContentFn = handleAcceptableErrors(getContentFn, example.ErrContentNotFound)
-
-	err := s.breaker.Do(getContentFn)
-	return resp, err
+// NewBreaker returns a breaker that does not count acceptable errors
+// against the content service, while still returning them to the caller.
+func NewBreaker(opts ...breaker.Option) breaker.Breaker {
+	opts = append(opts, breaker.WithErrorClassifier(acceptableErrors(example.ErrContentNotFound)))
+	return breaker.NewGoogleBreaker(opts...)
 }
 
-func handleAcceptableErrors(fn func() error, acceptableErrors ...error) func() error {
-	return func() error {
-		err := fn()
-		if err == nil {
-			return nil
-		}
+func (s *breakerContentService) GetContent(ctx context.Context, req *example.GetContentRequest) (*example.GetContentResponse, error) {
+	return breaker.ExecuteContext(ctx, s.breaker, func(ctx context.Context) (*example.GetContentResponse, error) {
+		return s.contentService.GetContent(ctx, req)
+	})
+}
 
-		for _, target := range acceptableErrors {
+func acceptableErrors(targets ...error) func(error) breaker.Outcome {
+	return func(err error) breaker.Outcome {
+		for _, target := range targets {
 			if errors.Is(err, target) {
 				// TODO: do something, like log
-				return nil
+				return breaker.OutcomeIgnored
 			}
 		}
 
-		return err
+		return breaker.ClassifyError(err)
 	}
 }
@@ -28,10 +28,8 @@ func NewBreakerContentService(
 }
 
 func (s *breakerContentService) GetContent(ctx context.Context, req *example.GetContentRequest) (*example.GetContentResponse, error) {
-	var resp *example.GetContentResponse
-	err := s.breaker.Do(func() (err error) {
-		resp, err = s.contentService.GetContent(ctx, req)
-		return err
+	resp, err := breaker.ExecuteContext(ctx, s.breaker, func(ctx context.Context) (*example.GetContentResponse, error) {
+		return s.contentService.GetContent(ctx, req)
 	})
 	if err == nil {
 		return resp, nil
@@ -22,10 +22,7 @@ func NewBreakerContentService(breaker breaker.Breaker, contentService example.Co
 }
 
 func (s *breakerContentService) GetContent(ctx context.Context, req *example.GetContentRequest) (*example.GetContentResponse, error) {
-	var resp *example.GetContentResponse
-	err := s.breaker.Do(func() (err error) {
-		resp, err = s.contentService.GetContent(ctx, req)
-		return err
+	return breaker.ExecuteContext(ctx, s.breaker, func(ctx context.Context) (*example.GetContentResponse, error) {
+		return s.contentService.GetContent(ctx, req)
 	})
-	return resp, err
 }
@@ -0,0 +1,38 @@
+package breaker
+
+import "context"
+
+// Execute runs fn through b and returns its result.
+func Execute[T any](b Breaker, fn func() (T, error)) (T, error) {
+	var result T
+	err := b.Do(func() (err error) {
+		result, err = fn()
+		return err
+	})
+	return result, err
+}
+
+// ExecuteContext runs fn through b with ctx and returns its result.
+//
+// If b does not implement ContextBreaker, a done ctx is still rejected
+// before b is consulted.
+func ExecuteContext[T any](ctx context.Context, b Breaker, fn func(context.Context) (T, error)) (T, error) {
+	var result T
+	err := doContext(ctx, b, func(ctx context.Context) (err error) {
+		result, err = fn(ctx)
+		return err
+	})
+	return result, err
+}
+
+func doContext(ctx context.Context, b Breaker, f func(context.Context) error) error {
+	if cb, ok := b.(ContextBreaker); ok {
+		return cb.DoContext(ctx, f)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return b.Do(func() error { return f(ctx) })
+}
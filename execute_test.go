@@ -0,0 +1,105 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// plainBreaker implements Breaker only, without the optional extensions.
+type plainBreaker struct{ calls int }
+
+func (b *plainBreaker) Do(f func() error) error {
+	b.calls++
+	return f()
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name    string
+		b       Breaker
+		fn      func() (int, error)
+		want    int
+		wantErr error
+	}{
+		{
+			name: "google breaker",
+			b:    NewGoogleBreaker(),
+			fn:   func() (int, error) { return 1, nil },
+			want: 1,
+		}, {
+			name: "plain breaker",
+			b:    &plainBreaker{},
+			fn:   func() (int, error) { return 1, nil },
+			want: 1,
+		}, {
+			name:    "inner error",
+			b:       NewGoogleBreaker(),
+			fn:      func() (int, error) { return 1, errTest },
+			want:    1,
+			wantErr: errTest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Execute(tt.b, tt.fn)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		b       Breaker
+		want    string
+		wantErr error
+	}{
+		{
+			name: "google breaker",
+			ctx:  context.Background(),
+			b:    NewGoogleBreaker(),
+			want: "ok",
+		}, {
+			name: "plain breaker",
+			ctx:  context.Background(),
+			b:    &plainBreaker{},
+			want: "ok",
+		}, {
+			name:    "google breaker with done context",
+			ctx:     canceled,
+			b:       NewGoogleBreaker(),
+			wantErr: context.Canceled,
+		}, {
+			name:    "plain breaker with done context",
+			ctx:     canceled,
+			b:       &plainBreaker{},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ExecuteContext(tt.ctx, tt.b, func(ctx context.Context) (string, error) {
+				if err := ctx.Err(); err != nil {
+					t.Error("fn must not be called with a done context")
+				}
+				return "ok", nil
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExecuteContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ExecuteContext() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,16 @@
 package breaker
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"math/rand/v2"
+	"reflect"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/chenyanchen/breaker/internal/rollingwindow"
+	"github.com/chenyanchen/breaker/rollingwindow"
 )
 
 const (
@@ -14,81 +20,459 @@ const (
 )
 
 type googleBreaker struct {
+	name string
+
 	k float64
 
+	minRequests  float64
+	maxDropRatio float64
+
+	// multipliers scale the drop ratio, per criticality.
+	multipliers [numCriticalities]float64
+
+	// minProbes requests are let through per bucket interval, probes
+	// counts them in the current interval.
+	minProbes int
+	probeMu   sync.Mutex
+	probeSlot int64
+	probes    int
+
+	classify func(error) Outcome
+
+	slowCallThreshold time.Duration
+	latencyHistogram  bool
+
+	size     int
+	interval time.Duration
+
+	now    func() time.Time
+	random func() float64
+
+	observer   Observer
+	thresholds []float64
+
+	// level is the number of thresholds below the last observed drop ratio.
+	level atomic.Int32
+
+	mode atomic.Int32
+
+	// lastFailure is the most recent error recorded as a failure.
+	lastFailure atomic.Pointer[failure]
+
+	// rejection is the error of the last dropped request, reused while the
+	// statistics do not change.
+	rejection atomic.Pointer[rejection]
+
 	stat *rollingwindow.RollingWindow
 }
 
-type Option func(*googleBreaker)
+// Option configures NewGoogleBreaker, by changing the Config it passes
+// to New.
+type Option func(*Config)
+
+// WithName sets the name of the breaker, reported in the errors it
+// returns.
+func WithName(name string) Option {
+	return func(cfg *Config) { cfg.Name = name }
+}
 
 func WithK(k float64) Option {
-	return func(b *googleBreaker) { b.k = k }
+	return func(cfg *Config) { cfg.K = k }
+}
+
+// WithMinRequests lets every request through until the rolling window has
+// recorded at least n requests, so a few failures of a low traffic
+// dependency do not throttle it. It defaults to 0.
+func WithMinRequests(n int) Option {
+	return func(cfg *Config) { cfg.MinRequests = n }
+}
+
+// WithMaxDropRatio caps the drop ratio at p, so a trickle of requests
+// always reaches a dependency that is down and its recovery is noticed.
+// It defaults to 1.
+func WithMaxDropRatio(p float64) Option {
+	return func(cfg *Config) { cfg.MaxDropRatio = p }
+}
+
+// WithMinProbes lets at least n requests through per bucket interval of
+// the rolling window, whatever the drop ratio. It defaults to 0.
+func WithMinProbes(n int) Option {
+	return func(cfg *Config) { cfg.MinProbes = n }
+}
+
+// WithSlowCallThreshold records the successful calls that take longer
+// than d as failures, so that a backend slowing down is throttled before
+// its calls start timing out. Zero, the default, disables it.
+func WithSlowCallThreshold(d time.Duration) Option {
+	return func(cfg *Config) { cfg.SlowCallThreshold = d }
+}
+
+// WithLatencyHistogram keeps a latency histogram of the calls over the
+// rolling window, queried by LatencyQuantile and reported by Stats.
+func WithLatencyHistogram() Option {
+	return func(cfg *Config) { cfg.LatencyHistogram = true }
+}
+
+// WithSnapshot seeds the rolling window with the buckets of a snapshot
+// returned by Stats, e.g. by a previous process, so that a restarted
+// breaker does not start blind.
+func WithSnapshot(s Stats) Option {
+	return func(cfg *Config) { cfg.Snapshot = s.Buckets }
+}
+
+// WithErrorClassifier sets how the errors returned by the protected call
+// are recorded. Errors classified as OutcomeIgnored are still returned to
+// the caller unchanged, but do not count for or against the backend.
+func WithErrorClassifier(classify func(error) Outcome) Option {
+	return func(cfg *Config) { cfg.ErrorClassifier = classify }
 }
 
 func WithWindow(size int, interval time.Duration) Option {
-	return func(b *googleBreaker) {
-		b.stat = rollingwindow.NewRollingWindow(size, interval)
+	return func(cfg *Config) {
+		cfg.WindowSize = size
+		cfg.WindowInterval = interval
 	}
 }
 
+// WithClock sets the clock of the breaker, it defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(cfg *Config) { cfg.Clock = now }
+}
+
+// WithRandSource sets the random source used to decide which requests to
+// drop, it defaults to the global source of math/rand/v2. The source does
+// not need to be safe for concurrent use, it is locked once and the lock is
+// shared by every breaker built with the option.
+func WithRandSource(src rand.Source) Option {
+	src = lockSource(src)
+	return func(cfg *Config) { cfg.RandSource = src }
+}
+
+// NewGoogleBreaker returns an adaptive throttling breaker configured by
+// DefaultConfig and opts. It panics if the resulting Config is not valid,
+// use New to get an error instead.
 func NewGoogleBreaker(opts ...Option) *googleBreaker {
-	b := &googleBreaker{
-		k:    defaultK,
-		stat: rollingwindow.NewRollingWindow(defaultSize, defaultInterval),
+	cfg := DefaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
 	}
 
-	for _, opt := range opts {
-		opt(b)
+	b, err := newGoogleBreaker(cfg)
+	if err != nil {
+		panic(err)
 	}
 
 	return b
 }
 
+// Reset clears the statistics of the breaker, e.g. after a known-bad
+// deploy of the dependency is rolled back.
+func (b *googleBreaker) Reset() {
+	b.stat.Reset()
+	b.lastFailure.Store(nil)
+	b.rejection.Store(nil)
+
+	b.probeMu.Lock()
+	b.probes = 0
+	b.probeMu.Unlock()
+
+	if b.observer != nil {
+		b.crossThresholds(0, 0, 0)
+	}
+}
+
 func (b *googleBreaker) Do(f func() error) error {
-	if err := b.accept(); err != nil {
+	return b.do(context.Background(), Critical, f)
+}
+
+// DoContext is like Do, but it rejects the call with ctx.Err() if ctx is
+// already done, and passes ctx through to f. The call is throttled by the
+// criticality carried by ctx, see ContextWithCriticality.
+//
+// An error returned after ctx has been canceled by the caller is not
+// counted as a backend failure. An exceeded deadline still is, since a
+// slow backend is what usually causes it.
+func (b *googleBreaker) DoContext(ctx context.Context, f func(context.Context) error) error {
+	return b.do(ctx, CriticalityFromContext(ctx), func() error { return f(ctx) })
+}
+
+func (b *googleBreaker) do(ctx context.Context, criticality Criticality, f func() error) error {
+	if err := ctx.Err(); err != nil {
 		return err
 	}
 
+	if err := b.accept(criticality); err != nil {
+		return err
+	}
+
+	var start time.Time
+	if b.timed() {
+		start = b.now()
+	}
+
 	defer func() {
 		if v := recover(); v != nil {
-			b.markFailure()
+			b.recordCall(start, OutcomeFailure, fmt.Errorf("call panicked: %v", v))
 			panic(v)
 		}
 	}()
 
 	err := f()
-	if err != nil {
-		b.markFailure()
-	} else {
-		b.markSuccess()
+	if err != nil && errors.Is(ctx.Err(), context.Canceled) {
+		// The caller gave up, the backend is not to blame.
+		return err
 	}
 
+	b.recordCall(start, b.classify(err), err)
+
 	return err
 }
 
-func (b *googleBreaker) accept() error {
-	accepts, requests := b.history()
+// Allow reports whether a call may proceed, for calls that cannot be
+// wrapped in Do. If it may, the outcome of the call must be reported
+// through done exactly once.
+func (b *googleBreaker) Allow() (done func(Outcome, error), err error) {
+	return b.allow(Critical)
+}
 
-	// https://sre.google/sre-book/handling-overload/#eq2101
-	dropRatio := (requests - b.k*accepts) / (requests + 1)
-	if dropRatio <= 0 {
+// AllowContext is like Allow, but it rejects the call with ctx.Err() if
+// ctx is already done, and throttles it by the criticality carried by
+// ctx, see ContextWithCriticality.
+func (b *googleBreaker) AllowContext(ctx context.Context) (done func(Outcome, error), err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	return b.allow(CriticalityFromContext(ctx))
+}
+
+func (b *googleBreaker) allow(criticality Criticality) (done func(Outcome, error), err error) {
+	if err = b.accept(criticality); err != nil {
+		return nil, err
+	}
+
+	var start time.Time
+	if b.timed() {
+		start = b.now()
+	}
+
+	return newPendingCall(func(outcome Outcome, err error) {
+		b.recordCall(start, outcome, err)
+	}), nil
+}
+
+// timed reports whether the latency of calls is needed.
+func (b *googleBreaker) timed() bool {
+	return b.slowCallThreshold > 0 || b.latencyHistogram
+}
+
+// recordCall records the outcome of a call started at start, and err as
+// the cause of the next rejections if it failed. A success that took
+// longer than the slow call threshold is recorded as a failure, caused by
+// ErrSlowCall.
+func (b *googleBreaker) recordCall(start time.Time, outcome Outcome, err error) {
+	var latency time.Duration
+	if b.timed() {
+		latency = b.now().Sub(start)
+	}
+
+	if outcome == OutcomeSuccess && b.slowCallThreshold > 0 && latency > b.slowCallThreshold {
+		outcome, err = OutcomeFailure, ErrSlowCall
+	}
+	if outcome == OutcomeFailure && err != nil {
+		b.storeFailure(err)
+	}
+
+	b.record(outcome, latency)
+}
+
+func (b *googleBreaker) accept(criticality Criticality) error {
+	mode := b.Mode()
+	if mode == ModeDisabled {
 		return nil
 	}
 
-	if rand.Float64() < dropRatio {
-		return ErrServiceUnavailable
+	accepts, requests := b.history()
+	dropRatio := b.dropRatio(accepts, requests)
+
+	if b.observer != nil {
+		b.crossThresholds(accepts, requests, dropRatio)
+	}
+
+	// ratio is the drop ratio of this request, by its criticality.
+	var ratio float64
+	var drop bool
+	switch mode {
+	case ModeForceOpen:
+		ratio, drop = 1, true
+	case ModeForceClosed:
+		drop = false
+	default:
+		ratio = b.scaledDropRatio(accepts, requests, b.multipliers[criticality])
+		drop = ratio > 0 && b.random() < ratio
+		if b.minProbes > 0 {
+			drop = !b.probe(drop)
+		}
+	}
+
+	if drop {
+		if b.observer != nil {
+			b.notify(EventDrop, accepts, requests, dropRatio)
+		}
+		return b.rejected(accepts, requests, ratio)
+	}
+
+	if b.observer != nil {
+		b.notify(EventAccept, accepts, requests, dropRatio)
 	}
 
 	return nil
 }
 
-func (b *googleBreaker) markSuccess() { b.stat.Add(1) }
-func (b *googleBreaker) markFailure() { b.stat.Add(0) }
+// storeFailure keeps err as the cause of the next rejections. The same
+// error failing again in the same bucket interval is not stored again, so
+// a failing dependency does not cost an allocation per call.
+func (b *googleBreaker) storeFailure(err error) {
+	slot := b.slot()
+	if f := b.lastFailure.Load(); f != nil && f.slot == slot && sameError(f.err, err) {
+		return
+	}
+
+	b.lastFailure.Store(&failure{err: err, slot: slot})
+}
+
+// cause returns the last failure, unless its bucket interval has left the
+// rolling window.
+func (b *googleBreaker) cause() *failure {
+	f := b.lastFailure.Load()
+	if f == nil || b.slot()-f.slot >= int64(b.size) {
+		return nil
+	}
+	return f
+}
+
+// slot is the index of the current bucket interval.
+func (b *googleBreaker) slot() int64 {
+	return b.now().UnixNano() / int64(b.interval)
+}
+
+// sameError reports whether a and b are the same error. Errors of struct
+// or array types are never the same, since comparing them may panic on a
+// field that is not comparable.
+func sameError(a, b error) bool {
+	t := reflect.TypeOf(b)
+	if !t.Comparable() || t.Kind() == reflect.Struct || t.Kind() == reflect.Array {
+		return false
+	}
+	return a == b
+}
+
+// rejected returns the error of a dropped request. The drop ratio may
+// fall once the window has moved to the next bucket, so that is when the
+// caller is told to retry.
+//
+// Dropped requests are not recorded, so the statistics stay the same
+// until an admitted call ends, and the error is shared meanwhile.
+func (b *googleBreaker) rejected(accepts, requests, dropRatio float64) *RejectedError {
+	cause := b.cause()
+	if r := b.rejection.Load(); r != nil && r.cause == cause &&
+		r.Accepts == accepts && r.Requests == requests && r.DropRatio == dropRatio {
+		return &r.RejectedError
+	}
+
+	r := &rejection{
+		RejectedError: RejectedError{
+			Name:       b.name,
+			DropRatio:  dropRatio,
+			Accepts:    accepts,
+			Requests:   requests,
+			RetryAfter: b.interval,
+		},
+		cause: cause,
+	}
+	if cause != nil {
+		r.Cause = cause.err
+	}
+	b.rejection.Store(r)
+
+	return &r.RejectedError
+}
+
+func (b *googleBreaker) dropRatio(accepts, requests float64) float64 {
+	return b.scaledDropRatio(accepts, requests, 1)
+}
+
+// scaledDropRatio is the drop ratio scaled by multiplier, e.g. the one of
+// a criticality, and then capped by the max drop ratio.
+func (b *googleBreaker) scaledDropRatio(accepts, requests, multiplier float64) float64 {
+	if requests < b.minRequests {
+		return 0
+	}
+
+	// https://sre.google/sre-book/handling-overload/#eq2101
+	dropRatio := (requests - b.k*accepts) / (requests + 1) * multiplier
+	return min(max(0, dropRatio), b.maxDropRatio)
+}
+
+// probe counts the requests let through in the current bucket interval,
+// and reports whether the request is let through: either it is not
+// dropped, or too few requests were let through yet.
+func (b *googleBreaker) probe(drop bool) bool {
+	b.probeMu.Lock()
+	defer b.probeMu.Unlock()
+
+	if slot := b.slot(); slot != b.probeSlot {
+		b.probeSlot = slot
+		b.probes = 0
+	}
+
+	if drop && b.probes >= b.minProbes {
+		return false
+	}
+
+	b.probes++
+	return true
+}
+
+func (b *googleBreaker) record(outcome Outcome, latency time.Duration) {
+	var kind EventKind
+	switch outcome {
+	case OutcomeSuccess:
+		b.markSuccess(latency)
+		kind = EventSuccess
+	case OutcomeFailure:
+		b.markFailure(latency)
+		kind = EventFailure
+	case OutcomeIgnored:
+		return
+	}
+
+	if b.observer != nil && b.Mode() != ModeDisabled {
+		accepts, requests := b.history()
+		dropRatio := b.dropRatio(accepts, requests)
+		b.notify(kind, accepts, requests, dropRatio)
+		b.crossThresholds(accepts, requests, dropRatio)
+	}
+}
+
+func (b *googleBreaker) markSuccess(latency time.Duration) { b.add(1, latency) }
+func (b *googleBreaker) markFailure(latency time.Duration) { b.add(0, latency) }
+
+func (b *googleBreaker) add(v float64, latency time.Duration) {
+	if b.latencyHistogram {
+		b.stat.AddWithLatency(v, latency)
+	} else {
+		b.stat.Add(v)
+	}
+}
+
+// LatencyQuantile returns the q-quantile of the latency of the calls over
+// the rolling window. It returns 0 unless WithLatencyHistogram is set.
+func (b *googleBreaker) LatencyQuantile(q float64) time.Duration {
+	latency := b.stat.Latency()
+	return latency.Quantile(q)
+}
 
 func (b *googleBreaker) history() (accepts, requests float64) {
-	b.stat.Reduce(func(b *rollingwindow.Bucket) {
-		accepts += b.Value
-		requests += b.Count
-	})
-	return
+	totals := b.stat.Totals()
+	return totals.Value, totals.Count
 }
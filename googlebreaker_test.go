@@ -1,9 +1,13 @@
 package breaker
 
 import (
+	"context"
 	"errors"
 	"math/rand"
 	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
 )
 
 var errTest = errors.New("test error")
@@ -35,17 +39,49 @@ func Test_googleBreaker_Do(t *testing.T) {
 			args:    args{f: func() error { return nil }},
 			wantErr: nil,
 		}, {
-			// This case is not 100% accurate, but it is enough to prove that the drop ratio is close to 99%.
-			name: "close 99% drop ratio",
+			name: "99% drop ratio",
 			breakerCreateFn: func() *googleBreaker {
-				breaker := NewGoogleBreaker(WithK(0.5))
+				src := breakertest.NewSource(0.999)
+				breaker := NewGoogleBreaker(WithK(0.5), WithRandSource(src))
 				for i := 0; i < 100; i++ {
 					_ = breaker.Do(func() error { return errTest })
 				}
+				// The drop ratio is 100/101 now.
+				src.Set(0.98)
 				return breaker
 			},
 			args:    args{f: func() error { return nil }},
 			wantErr: ErrServiceUnavailable,
+		}, {
+			name: "below drop ratio",
+			breakerCreateFn: func() *googleBreaker {
+				src := breakertest.NewSource(0.999)
+				breaker := NewGoogleBreaker(WithK(0.5), WithRandSource(src))
+				for i := 0; i < 100; i++ {
+					_ = breaker.Do(func() error { return errTest })
+				}
+				src.Set(0.995)
+				return breaker
+			},
+			args:    args{f: func() error { return nil }},
+			wantErr: nil,
+		}, {
+			name: "failures expired",
+			breakerCreateFn: func() *googleBreaker {
+				clock := breakertest.NewClock(time.Unix(0, 0))
+				breaker := NewGoogleBreaker(
+					WithWindow(2, time.Second),
+					WithClock(clock.Now),
+					WithRandSource(breakertest.NewSource(0)),
+				)
+				for i := 0; i < 100; i++ {
+					_ = breaker.Do(func() error { return errTest })
+				}
+				clock.Advance(time.Second * 2)
+				return breaker
+			},
+			args:    args{f: func() error { return nil }},
+			wantErr: nil,
 		},
 	}
 	for _, tt := range tests {
@@ -58,6 +94,308 @@ func Test_googleBreaker_Do(t *testing.T) {
 	}
 }
 
+func Test_googleBreaker_DoContext(t *testing.T) {
+	type ctxKey struct{}
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name         string
+		ctx          context.Context
+		f            func(ctx context.Context) error
+		wantErr      error
+		wantRequests float64
+	}{
+		{
+			name:         "success",
+			ctx:          context.Background(),
+			f:            func(context.Context) error { return nil },
+			wantErr:      nil,
+			wantRequests: 1,
+		}, {
+			name:         "inner error",
+			ctx:          context.Background(),
+			f:            func(context.Context) error { return errTest },
+			wantErr:      errTest,
+			wantRequests: 1,
+		}, {
+			name: "context passed through",
+			ctx:  context.WithValue(context.Background(), ctxKey{}, "v"),
+			f: func(ctx context.Context) error {
+				if ctx.Value(ctxKey{}) != "v" {
+					return errTest
+				}
+				return nil
+			},
+			wantErr:      nil,
+			wantRequests: 1,
+		}, {
+			name: "done context rejected",
+			ctx:  canceled,
+			f: func(context.Context) error {
+				t.Error("f must not be called with a done context")
+				return nil
+			},
+			wantErr:      context.Canceled,
+			wantRequests: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewGoogleBreaker()
+			if err := b.DoContext(tt.ctx, tt.f); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DoContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if _, requests := b.history(); requests != tt.wantRequests {
+				t.Errorf("DoContext() requests = %v, wantRequests %v", requests, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_DoContext_callerCanceled(t *testing.T) {
+	b := NewGoogleBreaker()
+	ctx, cancel := context.WithCancel(context.Background())
+	err := b.DoContext(ctx, func(ctx context.Context) error {
+		cancel()
+		return ctx.Err()
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DoContext() error = %v, wantErr %v", err, context.Canceled)
+	}
+	if _, requests := b.history(); requests != 0 {
+		t.Errorf("DoContext() requests = %v, want 0", requests)
+	}
+}
+
+func Test_googleBreaker_WithErrorClassifier(t *testing.T) {
+	errIgnored := errors.New("ignored error")
+	errHealthy := errors.New("healthy error")
+	classify := func(err error) Outcome {
+		switch {
+		case errors.Is(err, errIgnored):
+			return OutcomeIgnored
+		case errors.Is(err, errHealthy):
+			return OutcomeSuccess
+		default:
+			return ClassifyError(err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		f            func() error
+		wantErr      error
+		wantAccepts  float64
+		wantRequests float64
+	}{
+		{
+			name:         "success",
+			f:            func() error { return nil },
+			wantErr:      nil,
+			wantAccepts:  1,
+			wantRequests: 1,
+		}, {
+			name:         "failure",
+			f:            func() error { return errTest },
+			wantErr:      errTest,
+			wantAccepts:  0,
+			wantRequests: 1,
+		}, {
+			name:         "ignored",
+			f:            func() error { return errIgnored },
+			wantErr:      errIgnored,
+			wantAccepts:  0,
+			wantRequests: 0,
+		}, {
+			name:         "error as success",
+			f:            func() error { return errHealthy },
+			wantErr:      errHealthy,
+			wantAccepts:  1,
+			wantRequests: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewGoogleBreaker(WithErrorClassifier(classify))
+			if err := b.Do(tt.f); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			accepts, requests := b.history()
+			if accepts != tt.wantAccepts || requests != tt.wantRequests {
+				t.Errorf("history() = (%v, %v), want (%v, %v)", accepts, requests, tt.wantAccepts, tt.wantRequests)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_WithMinRequests(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []Option
+		failures int
+		wantErr  error
+	}{
+		{
+			name:     "a single failure throttles",
+			failures: 1,
+			wantErr:  ErrServiceUnavailable,
+		}, {
+			name:     "below min requests",
+			opts:     []Option{WithMinRequests(10)},
+			failures: 9,
+			wantErr:  nil,
+		}, {
+			name:     "reach min requests",
+			opts:     []Option{WithMinRequests(10)},
+			failures: 10,
+			wantErr:  ErrServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := breakertest.NewSource(0.999)
+			b := NewGoogleBreaker(append(tt.opts, WithRandSource(src))...)
+			for i := 0; i < tt.failures; i++ {
+				_ = b.Do(fail)
+			}
+
+			// Drop as soon as the drop ratio is above 0.
+			src.Set(0)
+			if err := b.Do(succeed); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_WithMaxDropRatio(t *testing.T) {
+	tests := []struct {
+		name    string
+		random  float64
+		wantErr error
+	}{
+		{
+			name:    "above the cap",
+			random:  0.6,
+			wantErr: nil,
+		}, {
+			name:    "below the cap",
+			random:  0.4,
+			wantErr: ErrServiceUnavailable,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := breakertest.NewSource(0.999)
+			b := NewGoogleBreaker(WithK(0.5), WithMaxDropRatio(0.5), WithRandSource(src))
+			for i := 0; i < 100; i++ {
+				_ = b.Do(fail)
+			}
+
+			src.Set(tt.random)
+			if err := b.Do(succeed); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_WithMinProbes(t *testing.T) {
+	// Failures in every bucket, so the drop ratio stays above 0 when the
+	// window moves to the next interval.
+	snapshot := Stats{Buckets: make([]Bucket, 10)}
+	for i := range snapshot.Buckets {
+		snapshot.Buckets[i] = Bucket{Accepts: 0, Requests: 10}
+	}
+
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := NewGoogleBreaker(
+		WithMinProbes(2),
+		WithWindow(10, time.Second),
+		WithClock(clock.Now),
+		WithRandSource(breakertest.NewSource(0)),
+		WithSnapshot(snapshot),
+	)
+
+	// Drop everything as soon as the drop ratio is above 0.
+	wantErrs := []error{errTest, errTest, ErrServiceUnavailable, ErrServiceUnavailable}
+	for i, wantErr := range wantErrs {
+		if err := b.Do(fail); !errors.Is(err, wantErr) {
+			t.Errorf("Do() #%d error = %v, wantErr %v", i, err, wantErr)
+		}
+	}
+
+	clock.Advance(time.Second)
+	if accepts, requests := b.history(); b.dropRatio(accepts, requests) == 0 {
+		t.Fatalf("drop ratio in next interval = 0, want above 0")
+	}
+	if err := b.Do(fail); !errors.Is(err, errTest) {
+		t.Errorf("Do() in next interval error = %v, wantErr %v", err, errTest)
+	}
+}
+
+func Test_googleBreaker_WithSlowCallThreshold(t *testing.T) {
+	tests := []struct {
+		name        string
+		latency     time.Duration
+		err         error
+		wantAccepts float64
+	}{
+		{
+			name:        "fast success",
+			latency:     time.Millisecond * 100,
+			wantAccepts: 1,
+		}, {
+			name:        "slow success",
+			latency:     time.Millisecond * 101,
+			wantAccepts: 0,
+		}, {
+			name:        "slow failure",
+			latency:     time.Second,
+			err:         errTest,
+			wantAccepts: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := breakertest.NewClock(time.Unix(0, 0))
+			b := NewGoogleBreaker(
+				WithSlowCallThreshold(time.Millisecond*100),
+				WithWindow(10, time.Minute),
+				WithClock(clock.Now),
+				WithRandSource(breakertest.NewSource(0.999)),
+			)
+
+			err := b.Do(func() error {
+				clock.Advance(tt.latency)
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.err)
+			}
+
+			accepts, requests := b.history()
+			if accepts != tt.wantAccepts || requests != 1 {
+				t.Errorf("history() = (%v, %v), want (%v, 1)", accepts, requests, tt.wantAccepts)
+			}
+
+			done, err := b.Allow()
+			if err != nil {
+				t.Fatalf("Allow() error = %v, wantErr nil", err)
+			}
+			clock.Advance(tt.latency)
+			done(ClassifyError(tt.err), tt.err)
+
+			accepts, requests = b.history()
+			if accepts != tt.wantAccepts*2 || requests != 2 {
+				t.Errorf("history() after Allow = (%v, %v), want (%v, 2)", accepts, requests, tt.wantAccepts*2)
+			}
+		})
+	}
+}
+
 func BenchmarkGoogleBreaker_Do(b *testing.B) {
 	breaker := NewGoogleBreaker()
 	b.RunParallel(func(pb *testing.PB) {
@@ -71,3 +409,26 @@ func BenchmarkGoogleBreaker_Do(b *testing.B) {
 		}
 	})
 }
+
+func BenchmarkGoogleBreaker_Do_failing(b *testing.B) {
+	breaker := NewGoogleBreaker()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = breaker.Do(fail)
+		}
+	})
+}
+
+func BenchmarkGoogleBreaker_Do_largeWindow(b *testing.B) {
+	breaker := NewGoogleBreaker(WithWindow(600, time.Millisecond*100))
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			_ = breaker.Do(func() error {
+				if rand.Float64() > 0.5 {
+					return errTest
+				}
+				return nil
+			})
+		}
+	})
+}
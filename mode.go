@@ -0,0 +1,68 @@
+package breaker
+
+// Mode is how a googleBreaker decides whether to let requests through.
+type Mode int32
+
+const (
+	// ModeAuto drops requests by the adaptive throttling, the default.
+	ModeAuto Mode = iota
+	// ModeForceOpen drops every request, outcomes are still recorded for
+	// the calls already let through.
+	ModeForceOpen
+	// ModeForceClosed lets every request through, outcomes are still
+	// recorded, so the breaker is not blind when it goes back to ModeAuto.
+	ModeForceClosed
+	// ModeDisabled takes the breaker out of the request path: every
+	// request is let through and nothing is observed, but outcomes are
+	// still recorded, so the breaker is not blind when it goes back to
+	// ModeAuto.
+	ModeDisabled
+)
+
+func (m Mode) String() string {
+	switch m {
+	case ModeAuto:
+		return "auto"
+	case ModeForceOpen:
+		return "force-open"
+	case ModeForceClosed:
+		return "force-closed"
+	case ModeDisabled:
+		return "disabled"
+	default:
+		return "unknown"
+	}
+}
+
+// Mode returns the current mode of the breaker.
+func (b *googleBreaker) Mode() Mode { return Mode(b.mode.Load()) }
+
+// ForceOpen drops every request until the mode is changed again.
+func (b *googleBreaker) ForceOpen() { b.setMode(ModeForceOpen) }
+
+// ForceClosed lets every request through until the mode is changed again.
+func (b *googleBreaker) ForceClosed() { b.setMode(ModeForceClosed) }
+
+// Disable takes the breaker out of the request path until the mode is
+// changed again.
+func (b *googleBreaker) Disable() { b.setMode(ModeDisabled) }
+
+// Auto goes back to the adaptive throttling.
+func (b *googleBreaker) Auto() { b.setMode(ModeAuto) }
+
+func (b *googleBreaker) setMode(mode Mode) {
+	prev := Mode(b.mode.Swap(int32(mode)))
+	if prev == mode || b.observer == nil {
+		return
+	}
+
+	accepts, requests := b.history()
+	b.observer.Observe(Event{
+		Kind:      EventMode,
+		Mode:      mode,
+		PrevMode:  prev,
+		Accepts:   accepts,
+		Requests:  requests,
+		DropRatio: b.dropRatio(accepts, requests),
+	})
+}
@@ -0,0 +1,119 @@
+package breaker
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func Test_googleBreaker_Mode(t *testing.T) {
+	tests := []struct {
+		name         string
+		setMode      func(b *googleBreaker)
+		f            func() error
+		wantMode     Mode
+		wantErr      error
+		wantRequests float64
+	}{
+		{
+			name:         "auto",
+			setMode:      func(b *googleBreaker) { b.Auto() },
+			f:            succeed,
+			wantMode:     ModeAuto,
+			wantErr:      ErrServiceUnavailable,
+			wantRequests: 1,
+		}, {
+			name:         "force open",
+			setMode:      func(b *googleBreaker) { b.ForceOpen() },
+			f:            succeed,
+			wantMode:     ModeForceOpen,
+			wantErr:      ErrServiceUnavailable,
+			wantRequests: 1,
+		}, {
+			name:         "force closed",
+			setMode:      func(b *googleBreaker) { b.ForceClosed() },
+			f:            succeed,
+			wantMode:     ModeForceClosed,
+			wantErr:      nil,
+			wantRequests: 2,
+		}, {
+			name:         "disabled",
+			setMode:      func(b *googleBreaker) { b.Disable() },
+			f:            fail,
+			wantMode:     ModeDisabled,
+			wantErr:      errTest,
+			wantRequests: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			observer := &recordingObserver{}
+			src := breakertest.NewSource(0.999)
+			b := NewGoogleBreaker(WithRandSource(src), WithObserver(observer))
+			_ = b.Do(fail)
+
+			// Drop as soon as the drop ratio is above 0.
+			src.Set(0)
+			tt.setMode(b)
+			observer.take()
+
+			if err := b.Do(tt.f); !errors.Is(err, tt.wantErr) {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			stats := b.Stats()
+			if stats.Mode != tt.wantMode {
+				t.Errorf("Stats().Mode = %v, want %v", stats.Mode, tt.wantMode)
+			}
+			if stats.Requests != tt.wantRequests {
+				t.Errorf("Stats().Requests = %v, want %v", stats.Requests, tt.wantRequests)
+			}
+			for _, e := range observer.take() {
+				if e.Mode != tt.wantMode {
+					t.Errorf("Event.Mode = %v, want %v", e.Mode, tt.wantMode)
+				}
+				if tt.wantMode == ModeDisabled {
+					t.Errorf("disabled breaker emitted %v", e.Kind)
+				}
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_setMode_event(t *testing.T) {
+	observer := &recordingObserver{}
+	b := NewGoogleBreaker(WithObserver(observer))
+
+	b.ForceOpen()
+	b.ForceOpen()
+	b.Auto()
+
+	events := observer.take()
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if e := events[0]; e.Kind != EventMode || e.PrevMode != ModeAuto || e.Mode != ModeForceOpen {
+		t.Errorf("events[0] = %+v, want auto to force-open", e)
+	}
+	if e := events[1]; e.Kind != EventMode || e.PrevMode != ModeForceOpen || e.Mode != ModeAuto {
+		t.Errorf("events[1] = %+v, want force-open to auto", e)
+	}
+}
+
+func Test_googleBreaker_Disable_keepsStatistics(t *testing.T) {
+	src := breakertest.NewSource(0.999)
+	b := NewGoogleBreaker(WithRandSource(src))
+
+	b.Disable()
+	for i := 0; i < 10; i++ {
+		_ = b.Do(fail)
+	}
+	b.Auto()
+
+	// Drop as soon as the drop ratio is above 0.
+	src.Set(0)
+	if err := b.Do(succeed); !errors.Is(err, ErrServiceUnavailable) {
+		t.Errorf("Do() after Auto() error = %v, wantErr %v", err, ErrServiceUnavailable)
+	}
+}
@@ -0,0 +1,129 @@
+package breaker
+
+// EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	// EventAccept is emitted when a request is let through.
+	EventAccept EventKind = iota
+	// EventDrop is emitted when a request is dropped.
+	EventDrop
+	// EventSuccess is emitted when a success is recorded.
+	EventSuccess
+	// EventFailure is emitted when a failure is recorded.
+	EventFailure
+	// EventThreshold is emitted when the drop ratio crosses one of the
+	// thresholds set by WithDropRatioThresholds.
+	EventThreshold
+	// EventMode is emitted when the mode of the breaker is changed.
+	EventMode
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventAccept:
+		return "accept"
+	case EventDrop:
+		return "drop"
+	case EventSuccess:
+		return "success"
+	case EventFailure:
+		return "failure"
+	case EventThreshold:
+		return "threshold"
+	case EventMode:
+		return "mode"
+	default:
+		return "unknown"
+	}
+}
+
+// Event describes a decision or a state change of a breaker, along with
+// the window snapshot it was made on.
+type Event struct {
+	Kind EventKind
+
+	// Mode is the mode of the breaker, and PrevMode the mode it was
+	// changed from, which is only set for EventMode.
+	Mode     Mode
+	PrevMode Mode
+
+	// Accepts and Requests are the counts over the rolling window.
+	Accepts  float64
+	Requests float64
+
+	// DropRatio is the probability of dropping a request, computed from
+	// Accepts and Requests.
+	DropRatio float64
+
+	// Threshold is the crossed threshold, and Above reports whether the
+	// drop ratio went above or came back to it. They are only set for
+	// EventThreshold.
+	Threshold float64
+	Above     bool
+}
+
+// Observer is notified of the events of a breaker.
+//
+// Observe is called synchronously on the request path, possibly from
+// many goroutines at once, so it must be fast and safe for concurrent use.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc adapts a function to an Observer.
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) { f(e) }
+
+// WithObserver sets the observer notified of the events of the breaker.
+func WithObserver(observer Observer) Option {
+	return func(cfg *Config) { cfg.Observer = observer }
+}
+
+// WithDropRatioThresholds sets the drop ratios whose crossing emits an
+// EventThreshold. It defaults to 0, which reports when the breaker starts
+// and stops dropping requests.
+func WithDropRatioThresholds(thresholds ...float64) Option {
+	return func(cfg *Config) { cfg.DropRatioThresholds = append([]float64(nil), thresholds...) }
+}
+
+func (b *googleBreaker) notify(kind EventKind, accepts, requests, dropRatio float64) {
+	b.observer.Observe(Event{
+		Kind:      kind,
+		Mode:      b.Mode(),
+		Accepts:   accepts,
+		Requests:  requests,
+		DropRatio: dropRatio,
+	})
+}
+
+// crossThresholds emits an EventThreshold for every threshold crossed
+// since the last observed drop ratio.
+func (b *googleBreaker) crossThresholds(accepts, requests, dropRatio float64) {
+	level := 0
+	for level < len(b.thresholds) && dropRatio > b.thresholds[level] {
+		level++
+	}
+
+	prev := int(b.level.Swap(int32(level)))
+
+	for i := prev; i < level; i++ {
+		b.notifyThreshold(accepts, requests, dropRatio, b.thresholds[i], true)
+	}
+	for i := prev - 1; i >= level; i-- {
+		b.notifyThreshold(accepts, requests, dropRatio, b.thresholds[i], false)
+	}
+}
+
+func (b *googleBreaker) notifyThreshold(accepts, requests, dropRatio, threshold float64, above bool) {
+	b.observer.Observe(Event{
+		Kind:      EventThreshold,
+		Mode:      b.Mode(),
+		Accepts:   accepts,
+		Requests:  requests,
+		DropRatio: dropRatio,
+		Threshold: threshold,
+		Above:     above,
+	})
+}
@@ -0,0 +1,122 @@
+package breaker
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+type recordingObserver struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (o *recordingObserver) Observe(e Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.events = append(o.events, e)
+}
+
+func (o *recordingObserver) take() []Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events := o.events
+	o.events = nil
+	return events
+}
+
+func Test_googleBreaker_WithObserver(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	src := breakertest.NewSource(0.999)
+	observer := &recordingObserver{}
+	b := NewGoogleBreaker(
+		WithWindow(2, time.Second),
+		WithClock(clock.Now),
+		WithRandSource(src),
+		WithObserver(observer),
+	)
+
+	// (2 - 1.5*1) / (2 + 1)
+	const dropRatio = 0.5 / 3
+
+	steps := []struct {
+		name   string
+		before func()
+		f      func() error
+		want   []Event
+	}{
+		{
+			name: "success",
+			f:    succeed,
+			want: []Event{
+				{Kind: EventAccept},
+				{Kind: EventSuccess, Accepts: 1, Requests: 1},
+			},
+		}, {
+			name: "failure starts dropping",
+			f:    fail,
+			want: []Event{
+				{Kind: EventAccept, Accepts: 1, Requests: 1},
+				{Kind: EventFailure, Accepts: 1, Requests: 2, DropRatio: dropRatio},
+				{Kind: EventThreshold, Accepts: 1, Requests: 2, DropRatio: dropRatio, Threshold: 0, Above: true},
+			},
+		}, {
+			name:   "drop",
+			before: func() { src.Set(0) },
+			f:      succeed,
+			want: []Event{
+				{Kind: EventDrop, Accepts: 1, Requests: 2, DropRatio: dropRatio},
+			},
+		}, {
+			name:   "window expired stops dropping",
+			before: func() { clock.Advance(time.Second * 2) },
+			f:      succeed,
+			want: []Event{
+				{Kind: EventThreshold, Threshold: 0, Above: false},
+				{Kind: EventAccept},
+				{Kind: EventSuccess, Accepts: 1, Requests: 1},
+			},
+		},
+	}
+	for _, step := range steps {
+		if step.before != nil {
+			step.before()
+		}
+		_ = b.Do(step.f)
+		if got := observer.take(); !reflect.DeepEqual(got, step.want) {
+			t.Errorf("%s: events = %+v, want %+v", step.name, got, step.want)
+		}
+	}
+}
+
+func Test_googleBreaker_WithDropRatioThresholds(t *testing.T) {
+	observer := &recordingObserver{}
+	b := NewGoogleBreaker(
+		WithK(1),
+		WithRandSource(breakertest.NewSource(0.999)),
+		WithObserver(observer),
+		WithDropRatioThresholds(0.5, 0.25),
+	)
+
+	// Drop ratios after each failure: 1/2, 2/3.
+	for i := 0; i < 2; i++ {
+		_ = b.Do(fail)
+	}
+
+	var got []Event
+	for _, e := range observer.take() {
+		if e.Kind == EventThreshold {
+			got = append(got, e)
+		}
+	}
+	want := []Event{
+		{Kind: EventThreshold, Requests: 1, DropRatio: 0.5, Threshold: 0.25, Above: true},
+		{Kind: EventThreshold, Requests: 2, DropRatio: 2.0 / 3, Threshold: 0.5, Above: true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
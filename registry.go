@@ -0,0 +1,220 @@
+package breaker
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry lazily creates and caches one breaker per name, e.g. per
+// upstream host or endpoint. It is safe for concurrent use.
+type Registry struct {
+	defaults  []Option
+	overrides map[string][]Option
+
+	newBreaker func(name string) Breaker
+
+	idleTimeout time.Duration
+	now         func() time.Time
+
+	mu      sync.RWMutex
+	entries map[string]*registryEntry
+
+	// lastSweep is the unix nano time of the last idle eviction.
+	lastSweep atomic.Int64
+}
+
+type registryEntry struct {
+	breaker Breaker
+
+	// lastUsed is the unix nano time of the last Get.
+	lastUsed atomic.Int64
+}
+
+type RegistryOption func(*Registry)
+
+// WithDefaultOptions sets the options of every breaker created by the
+// registry.
+func WithDefaultOptions(opts ...Option) RegistryOption {
+	return func(r *Registry) { r.defaults = append(r.defaults, opts...) }
+}
+
+// WithOverride sets extra options for the breaker of name, they are
+// applied after the default options.
+func WithOverride(name string, opts ...Option) RegistryOption {
+	return func(r *Registry) { r.overrides[name] = append(r.overrides[name], opts...) }
+}
+
+// WithFactory sets how the registry creates breakers, e.g. to use
+// NewClassicBreaker. The default and override options are not used when
+// a factory is set.
+func WithFactory(newBreaker func(name string) Breaker) RegistryOption {
+	return func(r *Registry) { r.newBreaker = newBreaker }
+}
+
+// WithIdleTimeout evicts the breakers that were not looked up by Get for
+// longer than d. Zero, the default, disables eviction.
+func WithIdleTimeout(d time.Duration) RegistryOption {
+	return func(r *Registry) { r.idleTimeout = d }
+}
+
+// WithRegistryClock sets the clock used for idle eviction, it defaults to
+// time.Now.
+func WithRegistryClock(now func() time.Time) RegistryOption {
+	return func(r *Registry) { r.now = now }
+}
+
+// NewRegistry returns a Registry configured by opts. Unless a factory is
+// set, it returns an error wrapping ErrInvalidConfig if the default or
+// override options of a breaker are not valid.
+func NewRegistry(opts ...RegistryOption) (*Registry, error) {
+	r := &Registry{
+		overrides: make(map[string][]Option),
+		now:       time.Now,
+		entries:   make(map[string]*registryEntry),
+	}
+
+	for _, opt := range opts {
+		opt(r)
+	}
+
+	if r.newBreaker == nil {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		r.newBreaker = r.newGoogleBreaker
+	}
+
+	r.lastSweep.Store(r.now().UnixNano())
+
+	return r, nil
+}
+
+// Get returns the breaker of name, creating it on first use.
+func (r *Registry) Get(name string) Breaker {
+	now := r.now().UnixNano()
+	r.evictIdle(now)
+
+	r.mu.RLock()
+	e, ok := r.entries[name]
+	r.mu.RUnlock()
+
+	if !ok {
+		r.mu.Lock()
+		if e, ok = r.entries[name]; !ok {
+			e = &registryEntry{breaker: r.newBreaker(name)}
+			e.lastUsed.Store(now)
+			r.entries[name] = e
+		}
+		r.mu.Unlock()
+	}
+
+	e.lastUsed.Store(now)
+
+	return e.breaker
+}
+
+// Range calls fn for every breaker in the registry, in name order, until
+// fn returns false.
+func (r *Registry) Range(fn func(name string, b Breaker) bool) {
+	r.mu.RLock()
+	names := make([]string, 0, len(r.entries))
+	breakers := make(map[string]Breaker, len(r.entries))
+	for name, e := range r.entries {
+		names = append(names, name)
+		breakers[name] = e.breaker
+	}
+	r.mu.RUnlock()
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !fn(name, breakers[name]) {
+			return
+		}
+	}
+}
+
+// Len returns the number of breakers in the registry.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return len(r.entries)
+}
+
+// Remove removes the breaker of name, the next Get creates a new one.
+func (r *Registry) Remove(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.entries, name)
+}
+
+// validate checks the Config of the breakers with the default options,
+// and of every override.
+func (r *Registry) validate() error {
+	cfg := r.config("")
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("default options: %w", err)
+	}
+
+	names := make([]string, 0, len(r.overrides))
+	for name := range r.overrides {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		cfg := r.config(name)
+		if err := cfg.Validate(); err != nil {
+			return fmt.Errorf("options of %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func (r *Registry) config(name string) Config {
+	cfg := DefaultConfig()
+	cfg.Name = name
+	for _, opt := range r.defaults {
+		opt(&cfg)
+	}
+	for _, opt := range r.overrides[name] {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+func (r *Registry) newGoogleBreaker(name string) Breaker {
+	b, err := newGoogleBreaker(r.config(name))
+	if err != nil {
+		// NewRegistry validated the options.
+		panic(err)
+	}
+	return b
+}
+
+// evictIdle removes the idle breakers, at most once per idle timeout.
+func (r *Registry) evictIdle(now int64) {
+	if r.idleTimeout <= 0 {
+		return
+	}
+
+	last := r.lastSweep.Load()
+	if now-last < int64(r.idleTimeout) || !r.lastSweep.CompareAndSwap(last, now) {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for name, e := range r.entries {
+		if now-e.lastUsed.Load() >= int64(r.idleTimeout) {
+			delete(r.entries, name)
+		}
+	}
+}
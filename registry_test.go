@@ -0,0 +1,172 @@
+package breaker
+
+import (
+	"errors"
+	"math/rand/v2"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func mustNewRegistry(tb testing.TB, opts ...RegistryOption) *Registry {
+	tb.Helper()
+	r, err := NewRegistry(opts...)
+	if err != nil {
+		tb.Fatalf("NewRegistry() error = %v", err)
+	}
+	return r
+}
+
+func TestNewRegistry(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []RegistryOption
+		wantErr error
+	}{
+		{name: "valid", opts: []RegistryOption{WithDefaultOptions(WithK(2)), WithOverride("a", WithK(3))}},
+		{name: "invalid default", opts: []RegistryOption{WithDefaultOptions(WithK(-1))}, wantErr: ErrInvalidConfig},
+		{name: "invalid override", opts: []RegistryOption{WithOverride("a", WithWindow(20, 0))}, wantErr: ErrInvalidConfig},
+		{
+			name: "factory ignores options",
+			opts: []RegistryOption{
+				WithDefaultOptions(WithK(-1)),
+				WithFactory(func(string) Breaker { return NewClassicBreaker() }),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewRegistry(tt.opts...)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("NewRegistry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (r == nil) != (tt.wantErr != nil) {
+				t.Errorf("NewRegistry() = %v, wantErr %v", r, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRegistry_Get(t *testing.T) {
+	r := mustNewRegistry(t,
+		WithDefaultOptions(WithK(2)),
+		WithOverride("slow", WithK(3)),
+	)
+
+	a := r.Get("a")
+	if a != r.Get("a") {
+		t.Error("Get() returned a different breaker for the same name")
+	}
+	if a == r.Get("b") {
+		t.Error("Get() returned the same breaker for different names")
+	}
+
+	if k := r.Get("a").(*googleBreaker).k; k != 2 {
+		t.Errorf("default k = %v, want 2", k)
+	}
+	if k := r.Get("slow").(*googleBreaker).k; k != 3 {
+		t.Errorf("override k = %v, want 3", k)
+	}
+}
+
+func TestRegistry_WithFactory(t *testing.T) {
+	r := mustNewRegistry(t, WithFactory(func(string) Breaker { return NewClassicBreaker() }))
+	if _, ok := r.Get("a").(*classicBreaker); !ok {
+		t.Errorf("Get() = %T, want *classicBreaker", r.Get("a"))
+	}
+}
+
+func TestRegistry_Range(t *testing.T) {
+	r := mustNewRegistry(t)
+	for _, name := range []string{"c", "a", "b"} {
+		r.Get(name)
+	}
+
+	var names []string
+	r.Range(func(name string, _ Breaker) bool {
+		names = append(names, name)
+		return name != "b"
+	})
+	if len(names) != 2 || names[0] != "a" || names[1] != "b" {
+		t.Errorf("Range() names = %v, want [a b]", names)
+	}
+
+	r.Remove("a")
+	if n := r.Len(); n != 2 {
+		t.Errorf("Len() = %v, want 2", n)
+	}
+}
+
+func TestRegistry_WithIdleTimeout(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	r := mustNewRegistry(t, WithIdleTimeout(time.Minute), WithRegistryClock(clock.Now))
+
+	idle := r.Get("idle")
+	busy := r.Get("busy")
+
+	clock.Advance(time.Second * 30)
+	if r.Get("busy") != busy {
+		t.Error("busy breaker was evicted")
+	}
+
+	clock.Advance(time.Second * 30)
+	if r.Get("busy") != busy {
+		t.Error("busy breaker was evicted")
+	}
+	if n := r.Len(); n != 1 {
+		t.Errorf("Len() = %v, want 1", n)
+	}
+	if r.Get("idle") == idle {
+		t.Error("idle breaker was not evicted")
+	}
+}
+
+func TestRegistry_concurrentGet(t *testing.T) {
+	r := mustNewRegistry(t)
+
+	var wg sync.WaitGroup
+	breakers := make([]Breaker, 8)
+	for i := range breakers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			breakers[i] = r.Get("a")
+		}(i)
+	}
+	wg.Wait()
+
+	for _, b := range breakers {
+		if b != breakers[0] {
+			t.Fatal("concurrent Get() created more than one breaker")
+		}
+	}
+}
+
+func TestRegistry_sharedRandSource(t *testing.T) {
+	r := mustNewRegistry(t, WithDefaultOptions(WithRandSource(rand.NewPCG(1, 2))))
+
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(b Breaker) {
+			defer wg.Done()
+			for range 100 {
+				_ = b.Do(fail)
+			}
+		}(r.Get(name))
+	}
+	wg.Wait()
+}
+
+func TestRegistry_Get_name(t *testing.T) {
+	r := mustNewRegistry(t, WithDefaultOptions(WithRandSource(breakertest.NewSource(0))))
+	b := r.Get("payments")
+	_ = b.Do(fail)
+
+	var rejected *RejectedError
+	if err := b.Do(succeed); !errors.As(err, &rejected) || rejected.Name != "payments" {
+		t.Errorf("Do() error = %v, want a *RejectedError of payments", err)
+	}
+}
@@ -0,0 +1,74 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrSlowCall is the Cause of the rejections following a call that took
+// longer than the slow call threshold, see WithSlowCallThreshold.
+var ErrSlowCall = errors.New("slow call")
+
+// RejectedError is the error a breaker returns when it rejects a call. It
+// matches ErrServiceUnavailable with errors.Is. A breaker may return the
+// same RejectedError for several calls, so it must not be modified.
+type RejectedError struct {
+	// Name is the name of the breaker, see WithName.
+	Name string
+
+	// DropRatio is the probability the call had to be rejected, it is 1
+	// for a breaker that rejects every call.
+	DropRatio float64
+
+	// Accepts and Requests are the statistics of the rolling window when
+	// the call was rejected.
+	Accepts  float64
+	Requests float64
+
+	// Cause is the most recent failure of the protected calls, if any. The
+	// breakers of NewGoogleBreaker forget it once it has left the rolling
+	// window. It is not unwrapped, so the rejection is not mistaken for
+	// that failure.
+	Cause error
+
+	// RetryAfter is how long the caller should wait before retrying, zero
+	// if there is no hint.
+	RetryAfter time.Duration
+}
+
+func (e *RejectedError) Error() string {
+	var sb strings.Builder
+
+	sb.WriteString("circuit breaker ")
+	if e.Name != "" {
+		fmt.Fprintf(&sb, "%q ", e.Name)
+	}
+	fmt.Fprintf(&sb, "is open: drop ratio %.2f, %g/%g requests accepted", e.DropRatio, e.Accepts, e.Requests)
+	if e.RetryAfter > 0 {
+		fmt.Fprintf(&sb, ", retry after %v", e.RetryAfter)
+	}
+	if e.Cause != nil {
+		fmt.Fprintf(&sb, ": last failure: %v", e.Cause)
+	}
+
+	return sb.String()
+}
+
+func (e *RejectedError) Unwrap() error { return ErrServiceUnavailable }
+
+// failure boxes an error, so it can be stored in an atomic.Pointer.
+type failure struct {
+	err error
+
+	// slot is the bucket interval the error was recorded in.
+	slot int64
+}
+
+// rejection is a RejectedError, with the failure its Cause comes from.
+type rejection struct {
+	RejectedError
+
+	cause *failure
+}
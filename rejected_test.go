@@ -0,0 +1,211 @@
+package breaker
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func TestRejectedError_Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  *RejectedError
+		want string
+	}{
+		{
+			name: "bare",
+			err:  &RejectedError{DropRatio: 1},
+			want: "circuit breaker is open: drop ratio 1.00, 0/0 requests accepted",
+		}, {
+			name: "full",
+			err: &RejectedError{
+				Name:       "payments",
+				DropRatio:  0.5,
+				Accepts:    1,
+				Requests:   4,
+				Cause:      errTest,
+				RetryAfter: time.Second,
+			},
+			want: `circuit breaker "payments" is open: drop ratio 0.50, 1/4 requests accepted, retry after 1s: last failure: ` + errTest.Error(),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.err.Error(); got != tt.want {
+				t.Errorf("Error() = %q, want %q", got, tt.want)
+			}
+			if !errors.Is(tt.err, ErrServiceUnavailable) {
+				t.Errorf("errors.Is(%v, ErrServiceUnavailable) = false, want true", tt.err)
+			}
+			if errors.Is(tt.err, errTest) {
+				t.Errorf("errors.Is(%v, errTest) = true, want false", tt.err)
+			}
+		})
+	}
+}
+
+func Test_googleBreaker_RejectedError(t *testing.T) {
+	src := breakertest.NewSource(0.999)
+	b := NewGoogleBreaker(
+		WithName("payments"),
+		WithWindow(10, time.Second),
+		WithRandSource(src),
+	)
+	_ = b.Do(succeed)
+	_ = b.Do(fail)
+
+	src.Set(0)
+	err := b.DoWithCriticality(Sheddable, succeed)
+
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("Do() error = %v, want a *RejectedError", err)
+	}
+	want := RejectedError{
+		Name: "payments",
+		// (2 - 1.5*1) / (2 + 1) * 2
+		DropRatio:  1.0 / 3,
+		Accepts:    1,
+		Requests:   2,
+		Cause:      errTest,
+		RetryAfter: time.Second,
+	}
+	if *rejected != want {
+		t.Errorf("Do() error = %+v, want %+v", *rejected, want)
+	}
+
+	b.ForceOpen()
+	if err = b.Do(succeed); !errors.As(err, &rejected) || rejected.DropRatio != 1 {
+		t.Errorf("Do() error = %v, want a *RejectedError with drop ratio 1", err)
+	}
+
+	b.Reset()
+	if err = b.Do(succeed); !errors.As(err, &rejected) || rejected.Cause != nil {
+		t.Errorf("Do() error = %v, want a *RejectedError without cause", err)
+	}
+}
+
+func Test_googleBreaker_RejectedError_cause(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := NewGoogleBreaker(
+		WithWindow(10, time.Second),
+		WithClock(clock.Now),
+		WithSlowCallThreshold(time.Second),
+	)
+
+	errFirst, errSecond := errors.New("first"), errors.New("second")
+	cause := func() error {
+		var rejected *RejectedError
+		if err := b.Do(succeed); !errors.As(err, &rejected) {
+			t.Fatalf("Do() error = %v, want a *RejectedError", err)
+		}
+		return rejected.Cause
+	}
+	call := func(f func() error) {
+		b.ForceClosed()
+		func() {
+			defer func() { _ = recover() }()
+			_ = b.Do(f)
+		}()
+		b.ForceOpen()
+	}
+
+	call(func() error { return errFirst })
+	call(func() error { return errSecond })
+	if got := cause(); got != errSecond {
+		t.Errorf("Cause = %v, want the latest failure %v", got, errSecond)
+	}
+
+	call(func() error {
+		clock.Advance(time.Second * 2)
+		return nil
+	})
+	if got := cause(); got != ErrSlowCall {
+		t.Errorf("Cause = %v, want %v", got, ErrSlowCall)
+	}
+
+	call(func() error { panic("boom") })
+	if got, want := fmt.Sprint(cause()), "call panicked: boom"; got != want {
+		t.Errorf("Cause = %v, want %v", got, want)
+	}
+
+	clock.Advance(time.Second * 10)
+	if got := cause(); got != nil {
+		t.Errorf("Cause = %v, want none once the failure left the window", got)
+	}
+}
+
+func Test_sameError(t *testing.T) {
+	uncomparable := uncomparableError{"a"}
+	wrapping := wrappingError{uncomparable}
+	tests := []struct {
+		name string
+		a, b error
+		want bool
+	}{
+		{name: "same", a: errTest, b: errTest, want: true},
+		{name: "different", a: errTest, b: ErrSlowCall, want: false},
+		{name: "uncomparable", a: uncomparable, b: uncomparable, want: false},
+		{name: "uncomparable field", a: wrapping, b: wrapping, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sameError(tt.a, tt.b); got != tt.want {
+				t.Errorf("sameError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type uncomparableError []string
+
+func (e uncomparableError) Error() string { return e[0] }
+
+type wrappingError struct{ err error }
+
+func (e wrappingError) Error() string { return e.err.Error() }
+
+func Test_googleBreaker_allocs(t *testing.T) {
+	b := NewGoogleBreaker()
+
+	b.ForceClosed()
+	if allocs := testing.AllocsPerRun(100, func() { _ = b.Do(fail) }); allocs != 0 {
+		t.Errorf("failed Do() allocs = %v, want 0", allocs)
+	}
+
+	b.ForceOpen()
+	if allocs := testing.AllocsPerRun(100, func() { _ = b.Do(succeed) }); allocs != 0 {
+		t.Errorf("rejected Do() allocs = %v, want 0", allocs)
+	}
+}
+
+func Test_classicBreaker_RejectedError(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := newTestClassicBreaker(clock,
+		WithClassicName("payments"),
+		WithMaxFailures(1),
+		WithOpenTimeout(time.Second),
+	)
+	_ = b.Do(fail)
+
+	clock.Advance(time.Millisecond * 300)
+	err := b.Do(succeed)
+
+	var rejected *RejectedError
+	if !errors.As(err, &rejected) {
+		t.Fatalf("Do() error = %v, want a *RejectedError", err)
+	}
+	want := RejectedError{
+		Name:       "payments",
+		DropRatio:  1,
+		Requests:   1,
+		Cause:      errTest,
+		RetryAfter: time.Millisecond * 700,
+	}
+	if *rejected != want {
+		t.Errorf("Do() error = %+v, want %+v", *rejected, want)
+	}
+}
@@ -0,0 +1,86 @@
+package rollingwindow
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mutexWindow is the RWMutex based window the lock-free RollingWindow
+// replaced, kept as the baseline of BenchmarkMutexWindow_AddTotals.
+type mutexWindow struct {
+	lock     sync.RWMutex
+	size     int
+	interval time.Duration
+	offset   int
+	buckets  []Bucket
+	lastTime time.Time
+}
+
+func newMutexWindow(size int, interval time.Duration) *mutexWindow {
+	return &mutexWindow{
+		size:     size,
+		interval: interval,
+		buckets:  make([]Bucket, size),
+		lastTime: time.Now(),
+	}
+}
+
+func (w *mutexWindow) Add(v float64) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.updateOffset()
+	w.buckets[w.offset].Value += v
+	w.buckets[w.offset].Count++
+}
+
+func (w *mutexWindow) updateOffset() {
+	span := min(w.span(), w.size)
+	if span <= 0 {
+		return
+	}
+
+	for i := 0; i < span; i++ {
+		w.buckets[(w.offset+i)%w.size].Reset()
+	}
+	w.offset = (w.offset + span) % w.size
+	w.lastTime = time.Now().Truncate(w.interval)
+}
+
+func (w *mutexWindow) Totals() Bucket {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	var totals Bucket
+	span := w.span()
+	for i := 0; i < w.size-span; i++ {
+		bucket := w.buckets[(w.offset+span+i)%w.size]
+		totals.Value += bucket.Value
+		totals.Count += bucket.Count
+	}
+
+	return totals
+}
+
+func (w *mutexWindow) span() int {
+	return int(time.Since(w.lastTime) / w.interval)
+}
+
+func BenchmarkMutexWindow_AddTotals(b *testing.B) {
+	for _, goroutines := range []int{8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			window := newMutexWindow(20, time.Millisecond*500)
+			b.SetParallelism(max(1, goroutines/runtime.GOMAXPROCS(0)))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = window.Totals()
+					window.Add(1)
+				}
+			})
+		})
+	}
+}
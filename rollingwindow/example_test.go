@@ -0,0 +1,27 @@
+package rollingwindow_test
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/chenyanchen/breaker/rollingwindow"
+)
+
+func Example() {
+	// Track the error ratio of recent calls, in buckets of a second.
+	w, err := rollingwindow.New(10, time.Second)
+	if err != nil {
+		panic(err)
+	}
+
+	for _, failed := range []bool{false, true, false, false} {
+		if failed {
+			w.Add(1)
+		} else {
+			w.Add(0)
+		}
+	}
+
+	fmt.Printf("%d calls, error ratio %.2f\n", int(w.Count()), w.Avg())
+	// Output: 4 calls, error ratio 0.25
+}
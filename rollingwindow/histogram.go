@@ -0,0 +1,132 @@
+package rollingwindow
+
+import (
+	"math"
+	"math/bits"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// subBinBits is the log2 of the number of bins per power of two, so a
+	// bin is at most 1/4 of its lower bound wide.
+	subBinBits = 2
+	subBins    = 1 << subBinBits
+
+	numBins = (64 - subBinBits + 1) * subBins
+)
+
+// Histogram counts durations in fixed log-scale bins, from 1ns up to the
+// maximum time.Duration. Quantiles are exact to within 12.5%.
+//
+// The zero value is an empty histogram, ready to use. It is not safe for
+// concurrent use.
+type Histogram struct {
+	bins  [numBins]uint32
+	count uint64
+}
+
+// Observe adds d to the histogram, negative durations count as 0.
+func (h *Histogram) Observe(d time.Duration) {
+	h.bins[binOf(d)]++
+	h.count++
+}
+
+// Merge adds the counts of o to the histogram.
+func (h *Histogram) Merge(o *Histogram) {
+	if o.count == 0 {
+		return
+	}
+
+	for i, n := range o.bins {
+		h.bins[i] += n
+	}
+	h.count += o.count
+}
+
+// Count returns the number of observed durations.
+func (h *Histogram) Count() uint64 { return h.count }
+
+// Quantile returns the q-quantile of the observed durations, for q in
+// [0, 1], as the middle of the bin it falls into. It returns 0 if the
+// histogram is empty.
+func (h *Histogram) Quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(min(max(q, 0), 1) * float64(h.count)))
+	rank = max(rank, 1)
+
+	var seen uint64
+	for i, n := range h.bins {
+		seen += uint64(n)
+		if seen >= rank {
+			lower, upper := binLower(i), binLower(i+1)
+			return time.Duration(lower + (upper-lower)/2)
+		}
+	}
+
+	return time.Duration(math.MaxInt64)
+}
+
+// Reset clears the histogram.
+func (h *Histogram) Reset() {
+	*h = Histogram{}
+}
+
+// histogram is the lock-free storage of a Histogram.
+type histogram struct {
+	bins  [numBins]atomic.Uint32
+	count atomic.Uint64
+}
+
+func (h *histogram) observe(d time.Duration) {
+	h.bins[binOf(d)].Add(1)
+	h.count.Add(1)
+}
+
+// mergeInto adds the counts of the histogram to dst.
+func (h *histogram) mergeInto(dst *Histogram) {
+	if h.count.Load() == 0 {
+		return
+	}
+
+	for i := range h.bins {
+		n := h.bins[i].Load()
+		dst.bins[i] += n
+		dst.count += uint64(n)
+	}
+}
+
+func (h *histogram) reset() {
+	for i := range h.bins {
+		h.bins[i].Store(0)
+	}
+	h.count.Store(0)
+}
+
+func binOf(d time.Duration) int {
+	v := uint64(max(d, 0))
+	if v < subBins {
+		return int(v)
+	}
+
+	exp := bits.Len64(v) - 1
+	mantissa := (v >> (exp - subBinBits)) & (subBins - 1)
+	return (exp-subBinBits+1)*subBins + int(mantissa)
+}
+
+// binLower returns the lowest duration, in nanoseconds, of bin i.
+func binLower(i int) uint64 {
+	if i < subBins {
+		return uint64(i)
+	}
+	if i >= numBins {
+		return math.MaxInt64
+	}
+
+	exp := i/subBins + subBinBits - 1
+	mantissa := uint64(i % subBins)
+	return (subBins + mantissa) << (exp - subBinBits)
+}
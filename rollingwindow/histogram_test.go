@@ -0,0 +1,79 @@
+package rollingwindow
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHistogram_Quantile(t *testing.T) {
+	var h Histogram
+	for i := 1; i <= 100; i++ {
+		h.Observe(time.Duration(i) * time.Millisecond)
+	}
+
+	tests := []struct {
+		q    float64
+		want time.Duration
+	}{
+		{q: 0, want: time.Millisecond},
+		{q: 0.5, want: time.Millisecond * 50},
+		{q: 0.9, want: time.Millisecond * 90},
+		{q: 0.99, want: time.Millisecond * 99},
+		{q: 1, want: time.Millisecond * 100},
+	}
+	for _, tt := range tests {
+		got := h.Quantile(tt.q)
+		if diff := float64(got-tt.want) / float64(tt.want); diff < -0.125 || diff > 0.125 {
+			t.Errorf("Quantile(%v) = %v, want %v within 12.5%%", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestHistogram_empty(t *testing.T) {
+	var h Histogram
+	if got := h.Quantile(0.5); got != 0 {
+		t.Errorf("Quantile() = %v, want 0", got)
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	var a, b Histogram
+	a.Observe(time.Millisecond)
+	b.Observe(time.Second)
+	b.Observe(time.Second)
+
+	a.Merge(&b)
+	if got := a.Count(); got != 3 {
+		t.Errorf("Count() = %v, want 3", got)
+	}
+	if got := a.Quantile(0.5); got < time.Second*7/8 || got > time.Second*9/8 {
+		t.Errorf("Quantile(0.5) = %v, want about 1s", got)
+	}
+}
+
+func TestHistogram_bins(t *testing.T) {
+	for _, d := range []time.Duration{0, 1, 3, 4, 5, 7, 8, 1000, time.Second, 1<<63 - 1} {
+		i := binOf(d)
+		if lower, upper := binLower(i), binLower(i+1); uint64(d) < lower || uint64(d) >= upper {
+			t.Errorf("binOf(%d) = %d, bin bounds [%d, %d)", d, i, lower, upper)
+		}
+	}
+}
+
+func TestRollingWindow_Latency(t *testing.T) {
+	clock := &fakeClock{current: time.Unix(0, 0)}
+	rollingWindow := mustNew(t, 2, span, WithClock(clock.Now), WithHistogram())
+	rollingWindow.AddWithLatency(1, time.Millisecond)
+	rollingWindow.AddWithLatency(1, time.Millisecond)
+
+	latency := rollingWindow.Latency()
+	if got := latency.Count(); got != 2 {
+		t.Errorf("Latency().Count() = %v, want 2", got)
+	}
+
+	clock.Advance(span * 2)
+	latency = rollingWindow.Latency()
+	if got := latency.Count(); got != 0 {
+		t.Errorf("Latency().Count() after expiry = %v, want 0", got)
+	}
+}
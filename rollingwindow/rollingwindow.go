@@ -0,0 +1,380 @@
+// Package rollingwindow provides a thread-safe time window of buckets,
+// to track values such as the success or error ratio of recent calls.
+//
+// Every Add goes to the bucket of the current interval, and the buckets
+// older than the window are dropped as time goes by.
+package rollingwindow
+
+import (
+	"errors"
+	"iter"
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrInvalidSize     = errors.New("rollingwindow: size must be greater than 0")
+	ErrInvalidInterval = errors.New("rollingwindow: interval must be greater than 0")
+)
+
+// RollingWindow defines a thread-safe rolling window to calculate
+// the events in buckets with time interval.
+//
+// Add, Reduce and Totals are lock-free: buckets are updated with atomics,
+// and only moving the window to a new bucket takes a lock, once per
+// interval. An Add racing with such a move may be counted in the previous
+// bucket, or twice in Totals until the next move.
+type RollingWindow struct {
+	// serializes the moves of the window
+	lock sync.Mutex
+
+	// window size
+	size int
+
+	// bucket time interval
+	interval time.Duration
+
+	// current bucket offset and last update time
+	position atomic.Pointer[position]
+
+	buckets []bucket
+
+	// sum of all buckets, updated by Add and recomputed on every move
+	totals bucket
+
+	// latency histograms of the buckets, nil unless WithHistogram is set
+	histograms []histogram
+
+	now func() time.Time
+}
+
+// position is replaced as a whole, so readers always see an offset and a
+// last update time that match.
+type position struct {
+	// current bucket offset
+	offset int
+
+	// last update time
+	lastTime time.Time
+}
+
+// Option configures a RollingWindow.
+type Option func(*options)
+
+type options struct {
+	now       func() time.Time
+	histogram bool
+}
+
+// WithClock sets the clock of the RollingWindow, it defaults to time.Now.
+func WithClock(now func() time.Time) Option {
+	return func(o *options) { o.now = now }
+}
+
+// WithHistogram keeps a latency Histogram per bucket, fed by
+// AddWithLatency and queried by Latency.
+func WithHistogram() Option {
+	return func(o *options) { o.histogram = true }
+}
+
+// New returns a RollingWindow of size buckets of time interval. It
+// returns ErrInvalidSize or ErrInvalidInterval if either is not positive.
+func New(size int, interval time.Duration, opts ...Option) (*RollingWindow, error) {
+	if size < 1 {
+		return nil, ErrInvalidSize
+	}
+	if interval <= 0 {
+		return nil, ErrInvalidInterval
+	}
+
+	o := options{now: time.Now}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	w := newRollingWindow(size, interval, o.now)
+	if o.histogram {
+		w.histograms = make([]histogram, size)
+	}
+
+	return w, nil
+}
+
+func newRollingWindow(size int, interval time.Duration, now func() time.Time) *RollingWindow {
+	if now == nil {
+		now = time.Now
+	}
+
+	w := &RollingWindow{
+		size:     size,
+		interval: interval,
+		buckets:  make([]bucket, size),
+		now:      now,
+	}
+
+	w.position.Store(&position{lastTime: now()})
+
+	return w
+}
+
+// Add adds v to the current bucket, and counts it.
+func (w *RollingWindow) Add(v float64) {
+	b := &w.buckets[w.updateOffset()]
+
+	// Add value to current Bucket.
+	b.add(v)
+	w.totals.add(v)
+}
+
+// AddWithLatency is like Add, and also observes latency in the histogram
+// of the current bucket, if the window keeps histograms.
+func (w *RollingWindow) AddWithLatency(v float64, latency time.Duration) {
+	offset := w.updateOffset()
+
+	w.buckets[offset].add(v)
+	w.totals.add(v)
+
+	if w.histograms != nil {
+		w.histograms[offset].observe(latency)
+	}
+}
+
+// updateOffset updates the offset of current bucket, and returns it.
+func (w *RollingWindow) updateOffset() int {
+	pos := w.position.Load()
+	if w.span(pos) <= 0 {
+		return pos.offset
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	// Calculate window span, another Add may have moved the window already.
+	pos = w.position.Load()
+	span := w.span(pos)
+	if span <= 0 {
+		return pos.offset
+	}
+
+	if span > w.size {
+		span = w.size
+	}
+
+	// Reset expired buckets, and the new current one, which may hold an
+	// Add that raced with the previous move.
+	for i := 0; i <= span && i < w.size; i++ {
+		w.resetBucket((pos.offset + i) % w.size)
+	}
+
+	// Move offset and update last update time.
+	next := &position{
+		offset:   (pos.offset + span) % w.size,
+		lastTime: w.now().Truncate(w.interval),
+	}
+	w.position.Store(next)
+
+	w.totals.store(w.sum())
+
+	return next.offset
+}
+
+// Reduce calls fn for every live bucket, the current one first. The
+// bucket passed to fn is a copy, only valid during the call.
+func (w *RollingWindow) Reduce(fn func(bucket *Bucket)) {
+	pos := w.position.Load()
+	span := w.span(pos)
+
+	var bucket Bucket
+	for i := 0; i < w.size-span; i++ {
+		bucket = w.buckets[(pos.offset+span+i)%w.size].load()
+		fn(&bucket)
+	}
+}
+
+// Buckets returns an iterator over copies of the live buckets, in the
+// same order as Reduce.
+func (w *RollingWindow) Buckets() iter.Seq[Bucket] {
+	return func(yield func(Bucket) bool) {
+		pos := w.position.Load()
+		span := w.span(pos)
+		for i := 0; i < w.size-span; i++ {
+			if !yield(w.buckets[(pos.offset+span+i)%w.size].load()) {
+				return
+			}
+		}
+	}
+}
+
+// Sum returns the sum of the values of the live buckets.
+func (w *RollingWindow) Sum() float64 {
+	return w.Totals().Value
+}
+
+// Count returns the number of values added to the live buckets.
+func (w *RollingWindow) Count() float64 {
+	return w.Totals().Count
+}
+
+// Avg returns the average of the values added to the live buckets, it
+// is 0 if there are none.
+func (w *RollingWindow) Avg() float64 {
+	totals := w.Totals()
+	if totals.Count == 0 {
+		return 0
+	}
+	return totals.Value / totals.Count
+}
+
+// Max returns the largest sum of a live bucket, among the buckets that
+// a value was added to. It is 0 if there are none.
+func (w *RollingWindow) Max() float64 {
+	return w.extreme(func(v, extreme float64) bool { return v > extreme })
+}
+
+// Min returns the smallest sum of a live bucket, among the buckets that
+// a value was added to. It is 0 if there are none.
+func (w *RollingWindow) Min() float64 {
+	return w.extreme(func(v, extreme float64) bool { return v < extreme })
+}
+
+// extreme returns the value of the non-empty live bucket that is better
+// than all others.
+func (w *RollingWindow) extreme(better func(v, extreme float64) bool) float64 {
+	var extreme float64
+	found := false
+	for bucket := range w.Buckets() {
+		if bucket.Count == 0 {
+			continue
+		}
+		if !found || better(bucket.Value, extreme) {
+			extreme, found = bucket.Value, true
+		}
+	}
+	return extreme
+}
+
+// Totals returns the sum of the live buckets in O(1), without allocating.
+func (w *RollingWindow) Totals() Bucket {
+	// Moving the window drops the expired buckets from the totals.
+	w.updateOffset()
+
+	return w.totals.load()
+}
+
+// sum returns the sum of all buckets.
+func (w *RollingWindow) sum() Bucket {
+	var sum Bucket
+	for i := range w.buckets {
+		bucket := w.buckets[i].load()
+		sum.Value += bucket.Value
+		sum.Count += bucket.Count
+	}
+	return sum
+}
+
+// Reset clears all buckets.
+func (w *RollingWindow) Reset() {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for i := range w.buckets {
+		w.resetBucket(i)
+	}
+	w.totals.reset()
+	w.position.Store(&position{lastTime: w.now()})
+}
+
+// Restore replaces the buckets with the given ones, in the order Reduce
+// walks them. Extra buckets are dropped, missing ones are left empty.
+func (w *RollingWindow) Restore(buckets []Bucket) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	for i := range w.buckets {
+		w.resetBucket(i)
+		if i < len(buckets) {
+			w.buckets[i].store(buckets[i])
+		}
+	}
+	w.totals.store(w.sum())
+	w.position.Store(&position{lastTime: w.now()})
+}
+
+// Latency returns the merged latency histogram of the live buckets, it is
+// empty if the window does not keep histograms.
+func (w *RollingWindow) Latency() Histogram {
+	var h Histogram
+
+	if w.histograms == nil {
+		return h
+	}
+
+	pos := w.position.Load()
+	span := w.span(pos)
+	for i := 0; i < w.size-span; i++ {
+		w.histograms[(pos.offset+span+i)%w.size].mergeInto(&h)
+	}
+
+	return h
+}
+
+func (w *RollingWindow) resetBucket(i int) {
+	w.buckets[i].reset()
+	if w.histograms != nil {
+		w.histograms[i].reset()
+	}
+}
+
+func (w *RollingWindow) span(pos *position) int {
+	return int(w.now().Sub(pos.lastTime) / w.interval)
+}
+
+// Bucket is the sum of the values added during an interval, and their
+// count.
+type Bucket struct {
+	Value float64
+	Count float64
+}
+
+// Reset zeroes the bucket.
+func (b *Bucket) Reset() {
+	b.Value, b.Count = 0, 0
+}
+
+// bucket is the lock-free storage of a Bucket.
+type bucket struct {
+	// float64 bits
+	value atomic.Uint64
+	count atomic.Uint64
+}
+
+func (b *bucket) add(v float64) {
+	if v != 0 {
+		for {
+			old := b.value.Load()
+			if b.value.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+				break
+			}
+		}
+	}
+	b.count.Add(1)
+}
+
+func (b *bucket) load() Bucket {
+	return Bucket{
+		Value: math.Float64frombits(b.value.Load()),
+		Count: float64(b.count.Load()),
+	}
+}
+
+func (b *bucket) store(bucket Bucket) {
+	b.value.Store(math.Float64bits(bucket.Value))
+	b.count.Store(uint64(bucket.Count))
+}
+
+func (b *bucket) reset() {
+	b.value.Store(0)
+	b.count.Store(0)
+}
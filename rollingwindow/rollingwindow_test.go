@@ -0,0 +1,318 @@
+package rollingwindow
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+const span = time.Millisecond * 10
+
+type fakeClock struct {
+	current time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.current
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.current = c.current.Add(d)
+}
+
+func mustNew(tb testing.TB, size int, interval time.Duration, opts ...Option) *RollingWindow {
+	tb.Helper()
+	rollingWindow, err := New(size, interval, opts...)
+	if err != nil {
+		tb.Fatalf("New() error = %v", err)
+	}
+	return rollingWindow
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		interval time.Duration
+		wantErr  error
+	}{
+		{name: "valid", size: 1, interval: span, wantErr: nil},
+		{name: "zero size", size: 0, interval: span, wantErr: ErrInvalidSize},
+		{name: "zero interval", size: 1, interval: 0, wantErr: ErrInvalidInterval},
+		{name: "negative interval", size: 1, interval: -span, wantErr: ErrInvalidInterval},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollingWindow, err := New(tt.size, tt.interval)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if (rollingWindow == nil) != (tt.wantErr != nil) {
+				t.Errorf("New() = %v, wantErr %v", rollingWindow, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRollingWindow_aggregates(t *testing.T) {
+	clock := &fakeClock{current: time.Unix(0, 0)}
+	rollingWindow := mustNew(t, 4, span, WithClock(clock.Now))
+	rollingWindow.Restore([]Bucket{{Value: 3, Count: 2}, {}, {Value: -1, Count: 1}, {Value: 6, Count: 3}})
+
+	if got := rollingWindow.Sum(); got != 8 {
+		t.Errorf("Sum() = %v, want 8", got)
+	}
+	if got := rollingWindow.Count(); got != 6 {
+		t.Errorf("Count() = %v, want 6", got)
+	}
+	if got := rollingWindow.Avg(); got != 8.0/6 {
+		t.Errorf("Avg() = %v, want %v", got, 8.0/6)
+	}
+	if got := rollingWindow.Max(); got != 6 {
+		t.Errorf("Max() = %v, want 6", got)
+	}
+	if got := rollingWindow.Min(); got != -1 {
+		t.Errorf("Min() = %v, want -1", got)
+	}
+
+	var got []Bucket
+	for bucket := range rollingWindow.Buckets() {
+		got = append(got, bucket)
+		if len(got) == 2 {
+			break
+		}
+	}
+	if want := []Bucket{{Value: 3, Count: 2}, {}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Buckets() = %v, want %v", got, want)
+	}
+
+	clock.Advance(span * 4)
+	for name, got := range map[string]float64{
+		"Sum":   rollingWindow.Sum(),
+		"Count": rollingWindow.Count(),
+		"Avg":   rollingWindow.Avg(),
+		"Max":   rollingWindow.Max(),
+		"Min":   rollingWindow.Min(),
+	} {
+		if got != 0 {
+			t.Errorf("%s() of an expired window = %v, want 0", name, got)
+		}
+	}
+}
+
+func TestRollingWindow_Reduce(t *testing.T) {
+	tests := []struct {
+		name           string
+		windowCreateFn func() *RollingWindow
+		wantCount      float64
+		wantSum        float64
+	}{
+		{
+			name: "all buckets are valid",
+			windowCreateFn: func() *RollingWindow {
+				clock := &fakeClock{current: time.Unix(0, 0)}
+				rollingWindow := newRollingWindow(2, span, clock.Now)
+				rollingWindow.Add(1 << 0)
+				rollingWindow.Add(1 << 1)
+				return rollingWindow
+			},
+			wantCount: 2,
+			wantSum:   3,
+		}, {
+			name: "all buckets are invalid",
+			windowCreateFn: func() *RollingWindow {
+				clock := &fakeClock{current: time.Unix(0, 0)}
+				rollingWindow := newRollingWindow(2, span, clock.Now)
+				rollingWindow.Add(1 << 0)
+				rollingWindow.Add(1 << 1)
+				clock.Advance(span)
+				return rollingWindow
+			},
+			wantCount: 0,
+			wantSum:   0,
+		}, {
+			name: "case 3",
+			windowCreateFn: func() *RollingWindow {
+				clock := &fakeClock{current: time.Unix(0, 0)}
+				rollingWindow := newRollingWindow(2, span, clock.Now)
+				rollingWindow.Add(1 << 0)
+				clock.Advance(span)
+				rollingWindow.Add(1 << 1)
+				return rollingWindow
+			},
+			wantCount: 1,
+			wantSum:   2,
+		}, {
+			name: "expire all buckets and add new buckets",
+			windowCreateFn: func() *RollingWindow {
+				clock := &fakeClock{current: time.Unix(0, 0)}
+				rollingWindow := newRollingWindow(2, span, clock.Now)
+				rollingWindow.Add(1 << 0)
+				clock.Advance(span)
+				rollingWindow.Add(1 << 1)
+				clock.Advance(span * 3)
+				rollingWindow.Add(1 << 2)
+				return rollingWindow
+			},
+			wantCount: 1,
+			wantSum:   4,
+		}, {
+			name: "reduce all expired buckets",
+			windowCreateFn: func() *RollingWindow {
+				clock := &fakeClock{current: time.Unix(0, 0)}
+				rollingWindow := newRollingWindow(2, span, clock.Now)
+				rollingWindow.Add(1 << 0)
+				clock.Advance(span)
+				rollingWindow.Add(1 << 1)
+				clock.Advance(span * 3)
+				return rollingWindow
+			},
+			wantCount: 0,
+			wantSum:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rollingWindow := tt.windowCreateFn()
+			var sum, count float64
+			rollingWindow.Reduce(func(bucket *Bucket) {
+				sum += bucket.Value
+				count += bucket.Count
+			})
+			if count != tt.wantCount {
+				t.Errorf("Reduce() count = %v, wantCount %v", count, tt.wantCount)
+				return
+			}
+			if sum != tt.wantSum {
+				t.Errorf("Reduce() sum = %v, wantSum %v", sum, tt.wantSum)
+				return
+			}
+			if totals := rollingWindow.Totals(); totals.Count != tt.wantCount || totals.Value != tt.wantSum {
+				t.Errorf("Totals() = %+v, wantCount %v, wantSum %v", totals, tt.wantCount, tt.wantSum)
+			}
+		})
+	}
+}
+
+func TestRollingWindow_Reset(t *testing.T) {
+	clock := &fakeClock{current: time.Unix(0, 0)}
+	rollingWindow := newRollingWindow(2, span, clock.Now)
+	rollingWindow.Add(1)
+	rollingWindow.Reset()
+
+	var count float64
+	rollingWindow.Reduce(func(bucket *Bucket) { count += bucket.Count })
+	if count != 0 {
+		t.Errorf("Reduce() count = %v, wantCount 0", count)
+	}
+}
+
+func TestRollingWindow_Restore(t *testing.T) {
+	clock := &fakeClock{current: time.Unix(0, 0)}
+	rollingWindow := newRollingWindow(3, span, clock.Now)
+	rollingWindow.Add(1 << 0)
+	rollingWindow.Add(1 << 1)
+
+	var buckets []Bucket
+	rollingWindow.Reduce(func(bucket *Bucket) { buckets = append(buckets, *bucket) })
+
+	restored := newRollingWindow(3, span, clock.Now)
+	restored.Restore(buckets)
+
+	var got []Bucket
+	restored.Reduce(func(bucket *Bucket) { got = append(got, *bucket) })
+	if len(got) != len(buckets) {
+		t.Fatalf("Reduce() got %d buckets, want %d", len(got), len(buckets))
+	}
+	for i := range got {
+		if got[i] != buckets[i] {
+			t.Errorf("Reduce() bucket %d = %v, want %v", i, got[i], buckets[i])
+		}
+	}
+}
+
+func TestRollingWindow_concurrentAdd(t *testing.T) {
+	rollingWindow := mustNew(t, 2, time.Hour)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				rollingWindow.Add(0.5)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if totals := rollingWindow.Totals(); totals.Count != 8000 || totals.Value != 4000 {
+		t.Errorf("Totals() = %+v, want {Value:4000 Count:8000}", totals)
+	}
+}
+
+// The benchmarks run with the given number of goroutines in total, which
+// is rounded up to a multiple of GOMAXPROCS, e.g. go test -bench . -cpu 8.
+func BenchmarkRollingWindow_AddTotals(b *testing.B) {
+	for _, goroutines := range []int{8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			rollingWindow := mustNew(b, 20, time.Millisecond*500)
+			b.SetParallelism(max(1, goroutines/runtime.GOMAXPROCS(0)))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					_ = rollingWindow.Totals()
+					rollingWindow.Add(1)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRollingWindow_AddReduce(b *testing.B) {
+	for _, goroutines := range []int{8, 16, 32, 64} {
+		b.Run(fmt.Sprintf("goroutines=%d", goroutines), func(b *testing.B) {
+			rollingWindow := mustNew(b, 20, time.Millisecond*500)
+			b.SetParallelism(max(1, goroutines/runtime.GOMAXPROCS(0)))
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					var count float64
+					rollingWindow.Reduce(func(bucket *Bucket) { count += bucket.Count })
+					rollingWindow.Add(1)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkRollingWindow_Totals(b *testing.B) {
+	for _, size := range []int{20, 600} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			rollingWindow := mustNew(b, size, time.Millisecond*100)
+			rollingWindow.Add(1)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = rollingWindow.Totals()
+			}
+		})
+	}
+}
+
+func BenchmarkRollingWindow_Reduce(b *testing.B) {
+	for _, size := range []int{20, 600} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			rollingWindow := mustNew(b, size, time.Millisecond*100)
+			rollingWindow.Add(1)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var count float64
+				rollingWindow.Reduce(func(bucket *Bucket) { count += bucket.Count })
+			}
+		})
+	}
+}
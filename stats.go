@@ -0,0 +1,69 @@
+package breaker
+
+import (
+	"time"
+
+	"github.com/chenyanchen/breaker/rollingwindow"
+)
+
+// Stats is a snapshot of a googleBreaker, for dashboards, debug endpoints
+// and assertions in tests.
+type Stats struct {
+	Mode Mode
+
+	// Accepts and Requests are the counts over the rolling window.
+	Accepts  float64
+	Requests float64
+
+	// DropRatio is the current probability of dropping a request.
+	DropRatio float64
+
+	K float64
+
+	WindowSize     int
+	WindowInterval time.Duration
+
+	// LatencyP50, LatencyP90 and LatencyP99 are quantiles of the latency of
+	// the calls over the rolling window, only set with WithLatencyHistogram.
+	LatencyP50 time.Duration
+	LatencyP90 time.Duration
+	LatencyP99 time.Duration
+
+	// Buckets are the live buckets of the rolling window, in window order.
+	// Expired buckets are left out.
+	Buckets []Bucket
+}
+
+// Bucket is the counts of one interval of the rolling window.
+type Bucket struct {
+	Accepts  float64
+	Requests float64
+}
+
+// Stats returns a snapshot of the breaker.
+func (b *googleBreaker) Stats() Stats {
+	s := Stats{
+		Mode:           b.Mode(),
+		K:              b.k,
+		WindowSize:     b.size,
+		WindowInterval: b.interval,
+		Buckets:        make([]Bucket, 0, b.size),
+	}
+
+	b.stat.Reduce(func(bucket *rollingwindow.Bucket) {
+		s.Buckets = append(s.Buckets, Bucket{Accepts: bucket.Value, Requests: bucket.Count})
+		s.Accepts += bucket.Value
+		s.Requests += bucket.Count
+	})
+
+	s.DropRatio = b.dropRatio(s.Accepts, s.Requests)
+
+	if b.latencyHistogram {
+		latency := b.stat.Latency()
+		s.LatencyP50 = latency.Quantile(0.5)
+		s.LatencyP90 = latency.Quantile(0.9)
+		s.LatencyP99 = latency.Quantile(0.99)
+	}
+
+	return s
+}
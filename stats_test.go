@@ -0,0 +1,113 @@
+package breaker
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/chenyanchen/breaker/breakertest"
+)
+
+func Test_googleBreaker_Stats(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := NewGoogleBreaker(
+		WithK(2),
+		WithWindow(3, time.Second),
+		WithClock(clock.Now),
+		WithRandSource(breakertest.NewSource(0.999)),
+	)
+
+	_ = b.Do(succeed)
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+
+	want := Stats{
+		Accepts:        1,
+		Requests:       4,
+		DropRatio:      (4 - 2*1) / (4 + 1.0),
+		K:              2,
+		WindowSize:     3,
+		WindowInterval: time.Second,
+		Buckets: []Bucket{
+			{Accepts: 1, Requests: 4},
+			{Accepts: 0, Requests: 0},
+			{Accepts: 0, Requests: 0},
+		},
+	}
+	if got := b.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %+v, want %+v", got, want)
+	}
+
+	clock.Advance(time.Second * 3)
+	want = Stats{
+		K:              2,
+		WindowSize:     3,
+		WindowInterval: time.Second,
+		Buckets:        []Bucket{},
+	}
+	if got := b.Stats(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() after expiry = %+v, want %+v", got, want)
+	}
+}
+
+func Test_googleBreaker_Reset(t *testing.T) {
+	observer := &recordingObserver{}
+	b := NewGoogleBreaker(WithObserver(observer))
+	_ = b.Do(fail)
+	observer.take()
+
+	b.Reset()
+
+	if stats := b.Stats(); stats.Requests != 0 || stats.DropRatio != 0 {
+		t.Errorf("Stats() after Reset = %+v, want empty", stats)
+	}
+	want := []Event{{Kind: EventThreshold, Threshold: 0, Above: false}}
+	if got := observer.take(); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %+v, want %+v", got, want)
+	}
+}
+
+func Test_googleBreaker_WithSnapshot(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := NewGoogleBreaker(WithClock(clock.Now))
+	_ = b.Do(succeed)
+	for i := 0; i < 3; i++ {
+		_ = b.Do(fail)
+	}
+	snapshot := b.Stats()
+
+	restored := NewGoogleBreaker(WithClock(clock.Now), WithSnapshot(snapshot))
+	if got := restored.Stats(); !reflect.DeepEqual(got, snapshot) {
+		t.Errorf("Stats() = %+v, want %+v", got, snapshot)
+	}
+}
+
+func Test_googleBreaker_WithLatencyHistogram(t *testing.T) {
+	clock := breakertest.NewClock(time.Unix(0, 0))
+	b := NewGoogleBreaker(WithLatencyHistogram(), WithWindow(10, time.Minute), WithClock(clock.Now))
+
+	for i := 1; i <= 100; i++ {
+		_ = b.Do(func() error {
+			clock.Advance(time.Duration(i) * time.Millisecond)
+			return nil
+		})
+	}
+
+	stats := b.Stats()
+	tests := []struct {
+		name string
+		got  time.Duration
+		want time.Duration
+	}{
+		{name: "LatencyP50", got: stats.LatencyP50, want: time.Millisecond * 50},
+		{name: "LatencyP90", got: stats.LatencyP90, want: time.Millisecond * 90},
+		{name: "LatencyP99", got: stats.LatencyP99, want: time.Millisecond * 99},
+		{name: "LatencyQuantile(1)", got: b.LatencyQuantile(1), want: time.Millisecond * 100},
+	}
+	for _, tt := range tests {
+		if diff := float64(tt.got-tt.want) / float64(tt.want); diff < -0.125 || diff > 0.125 {
+			t.Errorf("%s = %v, want %v within 12.5%%", tt.name, tt.got, tt.want)
+		}
+	}
+}